@@ -2,11 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
 	"k8s.io/klog/v2"
 
 	"github.com/anexia/csi-driver/pkg/driver"
+	"github.com/anexia/csi-driver/pkg/node"
+	"github.com/anexia/csi-driver/pkg/server"
 	"github.com/anexia/csi-driver/pkg/types"
 )
 
@@ -17,17 +31,121 @@ func main() {
 	var (
 		endpoint = flag.String("endpoint", "unix:///tmp/csi.sock", "CSI endpoint. unix:// is interpreted as relative path, tcp://hostname:port")
 		nodeID   = flag.String("nodeid", "", "node ID")
+		location = flag.String("location", "", "Identifier of the Anexia Engine location the node is running in, reported as topology segment")
+		nodeIP   = flag.String("node-ip", "", "IP address the node accesses NFS exports with, required for volumes with restricted access")
+
+		drainTimeout = flag.Duration("drain-timeout", 25*time.Second, "Time to wait for requests in progress when stopping, before aborting them")
+
+		tlsCertFile      = flag.String("tls-cert-file", "", "Path of the PEM encoded TLS certificate to serve the endpoint with, reloaded on change")
+		tlsKeyFile       = flag.String("tls-key-file", "", "Path of the PEM encoded key of the TLS certificate, reloaded on change")
+		tlsClientCAFile  = flag.String("tls-client-ca-file", "", "Path of the PEM encoded CA certificates to verify client certificates with, enables mutual TLS")
+		allowInsecureTCP = flag.Bool("allow-insecure-tcp", false, "Allow serving a tcp:// endpoint without TLS")
+
+		metricsAddress = flag.String("metrics-address", "", "Address to serve Prometheus metrics on at /metrics, e.g. ':9808'. Disabled if empty")
+		healthAddress  = flag.String("health-address", "", "Address to serve the /healthz and /readyz endpoints on, e.g. ':9898'. Disabled if empty")
+
+		tracingEndpoint    = flag.String("tracing-endpoint", "", "host:port of the OTLP gRPC receiver to export traces to, e.g. 'otel-collector:4317'. Disabled if empty")
+		tracingInsecure    = flag.Bool("tracing-insecure", false, "Export traces without TLS")
+		tracingSampleRatio = flag.Float64("tracing-sample-ratio", 1, "Ratio of requests to trace, from 0 to 1")
+
+		volumeProbeTimeout  = flag.Duration("volume-probe-timeout", 5*time.Second, "Time after which a volume that does not respond is reported as abnormal")
+		remountStaleVolumes = flag.Bool("remount-stale-volumes", false, "Remount volumes that are reported as abnormal, e.g. because of stale NFS file handles")
+
+		allowedMountOptions = flag.String("allowed-mount-options", "", "Comma-separated names of the mount options accepted for volumes, all options not denied are accepted if empty")
+		deniedMountOptions  = flag.String("denied-mount-options", strings.Join(node.DefaultDeniedMountOptions, ","), "Comma-separated names of the mount options rejected for volumes")
+
+		kubeletDir = flag.String("kubelet-dir", "/var/lib/kubelet", "Root directory of kubelet, orphaned volume mounts in it are cleaned up on start. Empty to disable")
+
+		credentialsDir = flag.String("credentials-dir", "", "Directory with a file per Anexia Engine token of StorageClasses, loaded on start. Empty to disable")
+
+		logFormat = flag.String("log-format", "text", "Format of the logs, one of 'text' or 'json'")
 	)
 
 	klog.InitFlags(nil)                               // Setup klog using the default flagset.
 	flag.Parse()                                      // Parse remaining flags (aka ours)
 	defer klog.FlushAndExit(klog.ExitFlushTimeout, 0) // Flush the logs on exit.
 
-	// Pass the default, now initialized klog logger, via the context.
-	ctx := klog.NewContext(context.Background(), klog.Background())
+	switch *logFormat {
+	case "text":
+	case "json":
+		klog.SetLogger(newJSONLogger(os.Stderr))
+	default:
+		klog.ErrorS(nil, "Invalid log format", "log_format", *logFormat)
+		return
+	}
+
+	// Pass the default, now initialized klog logger, via the context, which is cancelled
+	// when receiving a signal to stop.
+	ctx, stop := signal.NotifyContext(klog.NewContext(context.Background(), klog.Background()), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var nodeAddr netip.Addr
+	if *nodeIP != "" {
+		var err error
+		if nodeAddr, err = netip.ParseAddr(*nodeIP); err != nil {
+			klog.ErrorS(err, "Invalid node IP address", "node_ip", *nodeIP)
+			return
+		}
+	}
+
+	err := driver.Run(ctx, driver.Options{
+		Components: components,
+		Endpoint:   *endpoint,
+		NodeID:     *nodeID,
+		Location:   *location,
+		NodeIP:     nodeAddr,
 
-	err := driver.Run(ctx, components, *nodeID, *endpoint)
-	if err != nil {
+		DrainTimeout: *drainTimeout,
+
+		TLS: server.TLSOptions{
+			CertFile:     *tlsCertFile,
+			KeyFile:      *tlsKeyFile,
+			ClientCAFile: *tlsClientCAFile,
+		},
+		AllowInsecureTCP: *allowInsecureTCP,
+
+		MetricsAddress: *metricsAddress,
+		HealthAddress:  *healthAddress,
+
+		TracingEndpoint:    *tracingEndpoint,
+		TracingInsecure:    *tracingInsecure,
+		TracingSampleRatio: *tracingSampleRatio,
+
+		VolumeProbeTimeout:  *volumeProbeTimeout,
+		RemountStaleVolumes: *remountStaleVolumes,
+
+		AllowedMountOptions: splitList(*allowedMountOptions),
+		DeniedMountOptions:  splitList(*deniedMountOptions),
+
+		KubeletDir: *kubeletDir,
+
+		CredentialsDir: *credentialsDir,
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
 		klog.Error(err)
 	}
 }
+
+// splitList splits a comma-separated list given as flag value, ignoring empty entries.
+func splitList(value string) []string {
+	var entries []string
+	for entry := range strings.SplitSeq(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// newJSONLogger returns a logger writing every log line as JSON object to the given writer. It
+// passes all verbosity levels, so the verbosity is only filtered by klog.
+func newJSONLogger(w io.Writer) logr.Logger {
+	return funcr.NewJSON(func(obj string) {
+		fmt.Fprintln(w, obj)
+	}, funcr.Options{
+		LogTimestamp:    true,
+		TimestampFormat: time.RFC3339Nano,
+		Verbosity:       math.MaxInt32,
+	})
+}
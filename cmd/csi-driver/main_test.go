@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func TestJSONLoggerVerbosity(t *testing.T) {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	if err := flags.Set("v", "4"); err != nil {
+		t.Fatalf("Expected no error setting the verbosity, got %#v", err)
+	}
+	t.Cleanup(func() { _ = flags.Set("v", "0") })
+
+	var buf bytes.Buffer
+	klog.SetLogger(newJSONLogger(&buf))
+	t.Cleanup(klog.ClearLogger)
+
+	logger := klog.FromContext(context.Background())
+	logger.V(4).Info("Debug line")
+	logger.V(5).Info("Trace line")
+	klog.Flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"msg":"Debug line"`) {
+		t.Fatalf("Expected only the V(4) line to be logged, got %q", buf.String())
+	}
+}
@@ -2,7 +2,10 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"go.anx.io/go-anxcloud/pkg/api"
@@ -12,6 +15,8 @@ import (
 	"k8s.io/klog/v2"
 
 	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/internal/redact"
 )
 
 // For a discussion regarding those limits, see also SO-14229.
@@ -26,36 +31,118 @@ const (
 type controller struct {
 	csi.UnimplementedControllerServer
 
+	// engine is the API client with the token from the environment, used for requests
+	// without a token in their secrets. It's nil if no token is set in the environment.
 	engine api.API
+
+	// engines caches the API clients for tokens given in the secrets of requests,
+	// keyed by the hash of the token.
+	engines      map[string]api.API
+	enginesMutex sync.Mutex
+	newEngine    func(token string) (api.API, error)
+
+	// publishLocks serializes changes to the prefixes of a volume, which are
+	// read-modify-write operations at the Engine.
+	publishLocks inflight.Locker
+
+	// inflight tracks the operations in progress, to reject concurrent operations on the same volume.
+	inflight inflight.Tracker
+
+	// engineCheck caches the result of checking the Anexia Engine when probed.
+	engineCheck engineCheck
+}
+
+// Options configures the Controller component.
+type Options struct {
+	// CredentialsDir is a directory containing a file per Anexia Engine token given in the
+	// secrets of StorageClasses, like a mounted Secret. Volumes created with those tokens are
+	// managed right after starting, instead of only once a request with the token was received.
+	// Not used if empty.
+	CredentialsDir string
 }
 
 // New creates a fresh instance of the Controller component, ready to register to a GRPC server.
-func New() (csi.ControllerServer, error) {
+//
+// The token from the environment is optional, if all StorageClasses provide a token
+// in their secrets.
+func New(opts Options) (csi.ControllerServer, error) {
+	cs := &controller{newEngine: newEngineFromToken}
+
+	if opts.CredentialsDir != "" {
+		engines, err := loadCredentials(opts.CredentialsDir, cs.newEngine)
+		if err != nil {
+			return nil, fmt.Errorf("error loading credentials: %w", err)
+		}
+		cs.engines = engines
+	}
+
 	engine, err := api.NewAPI(api.WithClientOptions(client.TokenFromEnv(false)))
-	if err != nil {
+	if errors.Is(err, client.ErrEnvMissing) {
+		klog.V(0).InfoS("No Engine token set in the environment, only requests with a token in their secrets can be served")
+		return cs, nil
+	} else if err != nil {
 		return nil, fmt.Errorf("error creating API client with token from env: %w", err)
 	}
 
-	return &controller{engine: engine}, nil
+	cs.engine = instrumentAPI(engine)
+	return cs, nil
 }
 
 func (cs *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	klog.V(2).Info("Creating new volume")
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Creating new volume")
 	if err := checkCreateVolumeRequest(req); err != nil {
-		klog.V(2).ErrorS(err, "Volume request validation failed", "request", req)
+		logger.V(2).Error(err, "Volume request validation failed", "request", redact.Secrets(req))
 		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
 	}
 
-	klog.V(2).Info("Querying storage server interface from Anexia Engine")
-	storageServer, err := getDynamicStorageServer(ctx, cs.engine, req)
+	done, err := cs.inflight.Start(inflight.VolumeNameKey(req.GetName()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	restrictAccess, err := restrictAccessFromParameters(req.GetParameters())
+	if err != nil {
+		logger.V(2).Error(err, "Invalid parameters")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %s", err)
+	}
+
+	mountOptions, err := mountOptionsFromParameters(req.GetParameters())
+	if err != nil {
+		logger.V(2).Error(err, "Invalid parameters")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %s", err)
+	}
+
+	engine, err := cs.engineForSecrets(req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	logger.V(2).Info("Querying storage server interface from Anexia Engine")
+	storageServer, err := getDynamicStorageServer(ctx, engine, req)
 	if err != nil {
-		klog.V(2).ErrorS(err, "Failed to query storage server interface")
+		logger.V(2).Error(err, "Failed to query storage server interface")
 		return nil, engineErrorToGRPC(err)
 	}
 
-	volume, err := createAnexiaDynamicVolumeFromRequest(ctx, cs.engine, req)
+	// Volumes with restricted access are created with the deny-all prefix, so their export
+	// isn't accessible by anyone until they are published to a node.
+	var prefixIdentifiers []string
+	if restrictAccess {
+		prefix, err := findOrCreatePrefix(ctx, engine, denyAllPrefix)
+		if err != nil {
+			logger.V(2).Error(err, "Failed to query deny-all prefix", "prefix", denyAllPrefix)
+			return nil, engineErrorToGRPC(err)
+		}
+		prefixIdentifiers = []string{prefix.Identifier}
+	}
+
+	volume, err := createAnexiaDynamicVolumeFromRequest(ctx, engine, req, storageServer.Identifier, prefixIdentifiers)
 	if err != nil {
-		klog.V(2).ErrorS(err, "Volume creation in Anexia Engine failed")
+		logger.V(2).Error(err, "Volume creation in Anexia Engine failed")
 		return nil, engineErrorToGRPC(err)
 	}
 
@@ -71,18 +158,23 @@ func (cs *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeReq
 		//
 		// The codes.Unavailable code is meant for transient errors. Therefore this
 		// method is called again repeatedly until we can finally build that URL.
-		klog.V(2).ErrorS(err, "Volume likely not ready yet, construction of mount URL not possible")
+		logger.V(2).Error(err, "Volume likely not ready yet, construction of mount URL not possible")
 		return nil, status.Errorf(codes.Unavailable, "Volume not ready yet, construction of mount URL was not possible")
 	}
 
-	klog.V(4).Info("Volume successfully created", "id", volume.Identifier)
+	volumeContext := map[string]string{
+		"mountURL": mount,
+	}
+	maps.Copy(volumeContext, mountOptions)
+
+	logger.V(4).Info("Volume successfully created", "id", volume.Identifier)
 	resp := &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
-			VolumeId:      volume.Identifier,
-			CapacityBytes: volume.Size,
-			VolumeContext: map[string]string{
-				"mountURL": mount,
-			},
+			VolumeId:           volumeID{volume: volume.Identifier, storageServer: storageServer.Identifier, credentials: credentialsForSecrets(req.GetSecrets()), restrictAccess: restrictAccess}.String(),
+			CapacityBytes:      volume.Size,
+			VolumeContext:      volumeContext,
+			ContentSource:      req.GetVolumeContentSource(),
+			AccessibleTopology: accessibleTopology(storageServer, req.GetAccessibilityRequirements()),
 		},
 	}
 
@@ -90,30 +182,41 @@ func (cs *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeReq
 }
 
 func (cs *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
-	klog.V(2).InfoS("Deleting volume", "id", req.GetVolumeId())
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Deleting volume", "id", req.GetVolumeId())
 	if err := checkDeleteVolumeRequest(req); err != nil {
-		klog.V(4).ErrorS(err, "Volume request invalid", "request", req)
+		logger.V(4).Error(err, "Volume request invalid", "request", redact.Secrets(req))
 		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
 	}
 
-	klog.V(4).InfoS("Deleting ADV volume in Anexia Engine")
-	if err := cs.engine.Destroy(ctx, &dynamicvolumev1.Volume{Identifier: req.VolumeId}); api.IgnoreNotFound(err) != nil {
-		klog.V(2).ErrorS(err, "Volume deletion failed")
-		return nil, engineErrorToGRPC(err)
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
 	}
+	defer done()
 
-	klog.V(2).Info("Volume successfully deleted")
-	return &csi.DeleteVolumeResponse{}, nil
-}
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		// A volume with an invalid ID cannot exist, so there's nothing to delete.
+		logger.V(2).Error(err, "Invalid volume ID, treating volume as deleted")
+		return &csi.DeleteVolumeResponse{}, nil
+	}
 
-func (cs *controller) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	// intentional noop to allow non-breaking activation in the future
-	return &csi.ControllerPublishVolumeResponse{}, nil
-}
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	logger.V(4).Info("Deleting ADV volume in Anexia Engine")
+	if err := engine.Destroy(ctx, &dynamicvolumev1.Volume{Identifier: volumeID.volume}); api.IgnoreNotFound(err) != nil {
+		logger.V(2).Error(err, "Volume deletion failed")
+		return nil, engineErrorToGRPC(err)
+	}
 
-func (cs *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	// intentional noop to allow non-breaking activation in the future
-	return &csi.ControllerUnpublishVolumeResponse{}, nil
+	logger.V(2).Info("Volume successfully deleted")
+	return &csi.DeleteVolumeResponse{}, nil
 }
 
 func (cs *controller) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
@@ -134,6 +237,15 @@ func (cs *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Co
 				},
 			},
 
+			// Publishing grants nodes access to volumes with restricted access
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+					},
+				},
+			},
+
 			// Support for volume expansion API: https://kubernetes-csi.github.io/docs/volume-expansion.html
 			{
 				Type: &csi.ControllerServiceCapability_Rpc{
@@ -142,16 +254,102 @@ func (cs *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Co
 					},
 				},
 			},
+
+			// Support for volume snapshots: https://kubernetes-csi.github.io/docs/snapshot-restore-feature.html
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+					},
+				},
+			},
+
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+					},
+				},
+			},
+
+			// Support for volume health monitoring: https://kubernetes-csi.github.io/docs/volume-health-monitor.html
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_GET_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
+
+			// Support for storage capacity tracking: https://kubernetes-csi.github.io/docs/storage-capacity-tracking.html
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+					},
+				},
+			},
+
+			// Support for VolumeAttributesClass: https://kubernetes.io/docs/concepts/storage/volume-attributes-classes/
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+					},
+				},
+			},
+
+			// Support for volume cloning: https://kubernetes-csi.github.io/docs/volume-cloning.html
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+					},
+				},
+			},
 		},
 	}, nil
 }
 
 func (cs *controller) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	logger := klog.FromContext(ctx)
 	if err := checkValidateVolumeCapabilitiesRequest(req); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
 	}
 
-	if err := cs.engine.Get(ctx, &dynamicvolumev1.Volume{Identifier: req.GetVolumeId()}); err != nil {
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume not found: %s", err)
+	}
+
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	if err := engine.Get(ctx, &dynamicvolumev1.Volume{Identifier: volumeID.volume}); err != nil {
 		return nil, engineErrorToGRPC(err)
 	}
 
@@ -167,3 +365,137 @@ func (cs *controller) ValidateVolumeCapabilities(ctx context.Context, req *csi.V
 
 	return resp, nil
 }
+
+// ListVolumes returns the ADV volumes known to the Engine. Paging is done with an
+// offset encoded in the tokens.
+//
+// ListVolumes requests carry no secrets, so the volumes are listed with the token from the
+// environment and every token received in the secrets of other requests since the driver
+// started. Volumes of other tokens are missing until then.
+//
+// Volumes are reported with IDs in the current format, also when they were provisioned with
+// a legacy ID. Both IDs are accepted by all other requests and refer to the same volume.
+//
+// The nodes volumes are published to are not reported, as the Engine only knows the IP
+// addresses of the nodes volumes with restricted access are published to, not their IDs.
+func (cs *controller) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info("Listing volumes", "starting_token", req.GetStartingToken(), "max_entries", req.GetMaxEntries())
+
+	engines := cs.cachedEngines()
+	if engines == nil {
+		engines = make(map[string]api.API)
+	}
+	if cs.engine != nil {
+		engines[""] = cs.engine
+	}
+	if len(engines) == 0 {
+		err := status.Errorf(codes.FailedPrecondition, "no Engine token given, neither in the secrets of earlier requests nor in the environment")
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	volumes, err := listVolumesOfEngines(ctx, engines)
+	if err != nil {
+		logger.V(2).Error(err, "Listing volumes failed")
+		return nil, engineErrorToGRPC(err)
+	}
+
+	start, end, nextToken, err := paginate(len(volumes), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		logger.V(2).Error(err, "Invalid starting token", "starting_token", req.GetStartingToken())
+		return nil, status.Errorf(codes.Aborted, "invalid starting token: %s", err)
+	}
+
+	// Most volumes share the same storage server interface, so we only query each of them once.
+	storageServers := make(map[string]*dynamicvolumev1.StorageServerInterface)
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, end-start)
+	for _, listed := range volumes[start:end] {
+		volume := listed.volume
+		volumeContext, err := volumeContextForVolume(ctx, listed.engine, volume, "", storageServers)
+		if err != nil {
+			logger.V(2).Error(err, "Failed to query storage server interface of volume", "id", volume.Identifier)
+			return nil, engineErrorToGRPC(err)
+		}
+
+		volumeID := volumeIDForVolume(volume)
+		volumeID.credentials = listed.credentials
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      volumeID.String(),
+				CapacityBytes: volume.Size,
+				VolumeContext: volumeContext,
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				VolumeCondition: volumeCondition(volume),
+			},
+		})
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// ControllerGetVolume returns the current state of a volume, reporting volumes in
+// an error state as abnormal to the [Volume Health Monitor].
+//
+// ControllerGetVolume requests carry no secrets, so volumes created with a token from the
+// secrets of a StorageClass are queried with the token referenced in their ID.
+//
+// [Volume Health Monitor]: https://kubernetes-csi.github.io/docs/volume-health-monitor.html
+func (cs *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info("Getting volume", "id", req.GetVolumeId())
+	if req.GetVolumeId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", ErrVolumeIDNotProvided)
+	}
+
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume not found: %s", err)
+	}
+
+	engine, err := cs.engineForVolume(volumeID, nil)
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	volume := dynamicvolumev1.Volume{Identifier: volumeID.volume}
+	if err := engine.Get(ctx, &volume); err != nil {
+		logger.V(2).Error(err, "Failed to query volume", "id", req.GetVolumeId())
+		return nil, engineErrorToGRPC(err)
+	}
+
+	volumeContext, err := volumeContextForVolume(ctx, engine, &volume, volumeID.storageServer, map[string]*dynamicvolumev1.StorageServerInterface{})
+	if err != nil {
+		logger.V(2).Error(err, "Failed to query storage server interface of volume", "id", volume.Identifier)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	condition := volumeCondition(&volume)
+	if condition.GetAbnormal() {
+		logger.V(2).Info("Volume is in an abnormal condition", "id", volume.Identifier, "message", condition.GetMessage())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      req.GetVolumeId(),
+			CapacityBytes: volume.Size,
+			VolumeContext: volumeContext,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
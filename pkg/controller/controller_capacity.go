@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/klog/v2"
+)
+
+// GetCapacity implements the support for [Storage Capacity Tracking].
+//
+// The available capacity is the sum of the free space of all ADV quotas matching the
+// ADS class and storage server interfaces given as StorageClass parameters. If one of
+// the parameters is not set, quotas are not filtered by it.
+//
+// When queried for a topology, only the configured storage server interfaces located
+// in it are taken into account.
+//
+// GetCapacity requests carry no secrets and nothing identifying the token of a StorageClass,
+// so the quotas are always queried with the token from the environment.
+//
+// [Storage Capacity Tracking]: https://kubernetes-csi.github.io/docs/storage-capacity-tracking.html
+func (cs *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	logger := klog.FromContext(ctx)
+	var (
+		adsClass          = req.GetParameters()["csi.anx.io/ads-class"]
+		storageServerIDs  = storageServerIdentifiers(req.GetParameters()["csi.anx.io/storage-server-identifier"])
+		availableCapacity int64
+	)
+	logger.V(4).Info("Querying capacity", "ads_class", adsClass, "storage_server_identifiers", storageServerIDs, "topology", req.GetAccessibleTopology().GetSegments())
+
+	engine, err := cs.engineForSecrets(nil)
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	if req.GetAccessibleTopology() != nil && len(storageServerIDs) > 0 {
+		if storageServerIDs, err = storageServersInTopology(ctx, engine, storageServerIDs, req.GetAccessibleTopology()); err != nil {
+			logger.V(2).Error(err, "Querying storage server interfaces failed")
+			return nil, engineErrorToGRPC(err)
+		}
+
+		if len(storageServerIDs) == 0 {
+			logger.V(4).Info("No storage server interface in the queried topology")
+			return &csi.GetCapacityResponse{MaximumVolumeSize: wrapperspb.Int64(0)}, nil
+		}
+	}
+
+	quotas, err := listAnexiaQuotas(ctx, engine)
+	if err != nil {
+		logger.V(2).Error(err, "Listing quotas failed")
+		return nil, engineErrorToGRPC(err)
+	}
+
+	for _, quota := range quotas {
+		if !quotaMatches(quota, adsClass, storageServerIDs) {
+			continue
+		}
+
+		if free := quota.Limit - quota.Used; free > 0 {
+			availableCapacity += free
+		}
+	}
+
+	logger.V(4).Info("Capacity queried successfully", "available_capacity", availableCapacity)
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: availableCapacity,
+		MaximumVolumeSize: wrapperspb.Int64(min(availableCapacity, maxVolumeSize)),
+	}, nil
+}
+
+func listAnexiaQuotas(ctx context.Context, engine types.API) ([]*dynamicvolumev1.Quota, error) {
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.Quota{}, api.ObjectChannel(&channel), api.FullObjects(true)); err != nil {
+		return nil, fmt.Errorf("failed listing quotas: %w", err)
+	}
+
+	var quotas []*dynamicvolumev1.Quota
+	for retriever := range channel {
+		var quota dynamicvolumev1.Quota
+		if err := retriever(&quota); err != nil {
+			return nil, fmt.Errorf("failed retrieving quota: %w", err)
+		}
+
+		quotas = append(quotas, &quota)
+	}
+
+	return quotas, nil
+}
+
+// storageServersInTopology returns the identifiers of the given storage server interfaces
+// located in the topology.
+func storageServersInTopology(ctx context.Context, engine types.API, identifiers []string, topology *csi.Topology) ([]string, error) {
+	var result []string
+	for _, identifier := range identifiers {
+		storageServer := dynamicvolumev1.StorageServerInterface{Identifier: identifier}
+		if err := engine.Get(ctx, &storageServer); err != nil {
+			return nil, fmt.Errorf("failed retrieving storage server interface: %w", err)
+		}
+
+		if storageServerInTopology(&storageServer, topology) {
+			result = append(result, identifier)
+		}
+	}
+
+	return result, nil
+}
+
+func quotaMatches(quota *dynamicvolumev1.Quota, adsClass string, storageServerIDs []string) bool {
+	if adsClass != "" && quota.ADSClass != adsClass {
+		return false
+	}
+
+	if len(storageServerIDs) > 0 && (quota.StorageServerInterface == nil || !slices.Contains(storageServerIDs, quota.StorageServerInterface.Identifier)) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	csitypes "github.com/anexia/csi-driver/pkg/types"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller Service Capacity", func() {
+	var (
+		cs     *controller
+		engine *mockapi.MockAPI
+	)
+
+	quotas := []dynamicvolumev1.Quota{
+		{
+			ADSClass:               "ENT2",
+			StorageServerInterface: &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server-1"},
+			Limit:                  100 * oneGibibyteInBytes,
+			Used:                   40 * oneGibibyteInBytes,
+		},
+		{
+			ADSClass:               "ENT2",
+			StorageServerInterface: &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server-2"},
+			Limit:                  20 * oneGibibyteInBytes,
+			Used:                   30 * oneGibibyteInBytes,
+		},
+		{
+			ADSClass:               "ENT6",
+			StorageServerInterface: &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server-1"},
+			Limit:                  50 * 1024 * oneGibibyteInBytes,
+		},
+	}
+
+	BeforeEach(func() {
+		c := gomock.NewController(GinkgoT())
+		engine = mockapi.NewMockAPI(c)
+		cs = &controller{engine: engine}
+	})
+
+	Context("GetCapacity", func() {
+		DescribeTable("sums up the free capacity of matching quotas",
+			func(parameters map[string]string, availableCapacity, maximumVolumeSize int64) {
+				engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Quota{}, gomock.Any()).DoAndReturn(listReturning(quotas...))
+
+				resp, err := cs.GetCapacity(context.TODO(), &csi.GetCapacityRequest{Parameters: parameters})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.AvailableCapacity).To(Equal(availableCapacity))
+				Expect(resp.MaximumVolumeSize.GetValue()).To(Equal(maximumVolumeSize))
+			},
+			Entry("filtered by ADS class and storage server interface",
+				map[string]string{"csi.anx.io/ads-class": "ENT2", "csi.anx.io/storage-server-identifier": "storage-server-1"},
+				60*oneGibibyteInBytes, 60*oneGibibyteInBytes,
+			),
+			Entry("ignoring exceeded quotas",
+				map[string]string{"csi.anx.io/ads-class": "ENT2"},
+				60*oneGibibyteInBytes, 60*oneGibibyteInBytes,
+			),
+			Entry("limiting the maximum volume size",
+				map[string]string{"csi.anx.io/ads-class": "ENT6"},
+				50*1024*oneGibibyteInBytes, maxVolumeSize,
+			),
+			Entry("for an unknown ADS class",
+				map[string]string{"csi.anx.io/ads-class": "ENT1"},
+				int64(0), int64(0),
+			),
+		)
+
+		It("filters storage server interfaces by topology", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.Location.Identifier = map[string]string{"storage-server-1": "location-a", "storage-server-2": "location-b"}[s.Identifier]
+				return nil
+			}).Times(2)
+			engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Quota{}, gomock.Any()).DoAndReturn(listReturning(quotas...))
+
+			resp, err := cs.GetCapacity(context.TODO(), &csi.GetCapacityRequest{
+				Parameters:         map[string]string{"csi.anx.io/storage-server-identifier": "storage-server-1,storage-server-2"},
+				AccessibleTopology: &csi.Topology{Segments: map[string]string{csitypes.TopologyKeyLocation: "location-a"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.AvailableCapacity).To(Equal(60*oneGibibyteInBytes + 50*1024*oneGibibyteInBytes))
+		})
+
+		It("reports no capacity if no storage server interface is in the topology", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.Location.Identifier = "location-a"
+				return nil
+			})
+
+			resp, err := cs.GetCapacity(context.TODO(), &csi.GetCapacityRequest{
+				Parameters:         map[string]string{"csi.anx.io/storage-server-identifier": "storage-server-1"},
+				AccessibleTopology: &csi.Topology{Segments: map[string]string{csitypes.TopologyKeyLocation: "location-b"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.AvailableCapacity).To(BeZero())
+		})
+
+		// GetCapacity requests carry no secrets, so capacity is only reported for the token from the environment.
+		It("returns a FailedPrecondition error without a token from the environment", func() {
+			cs.engine = nil
+
+			_, err := cs.GetCapacity(context.TODO(), &csi.GetCapacityRequest{})
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		})
+
+		It("returns engine errors", func() {
+			engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+
+			_, err := cs.GetCapacity(context.TODO(), &csi.GetCapacityRequest{})
+			Expect(status.Code(err)).To(Equal(codes.Unknown))
+		})
+	})
+})
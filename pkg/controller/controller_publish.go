@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	csitypes "github.com/anexia/csi-driver/pkg/types"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// denyAllPrefix is set as the only prefix of volumes with restricted access, while they
+// aren't published to any node. An empty list of prefixes makes an export accessible by
+// everyone, while no client reaches the storage server with its loopback address.
+const denyAllPrefix = "127.0.0.1/32"
+
+// ControllerPublishVolume resolves the current mount URL of the volume, which is passed
+// to the node in the publish context. This way, nodes keep working with existing volumes
+// even if the IP address of their storage server interface changes.
+//
+// For volumes with restricted access, the node is additionally granted access to the
+// volume by adding a prefix containing the IP address of the node to the ADV volume,
+// replacing the deny-all prefix of volumes not published to any node yet.
+func (cs *controller) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Publishing volume", "id", req.GetVolumeId(), "node_id", req.GetNodeId())
+	if err := checkControllerPublishVolumeRequest(req); err != nil {
+		logger.V(2).Error(err, "Publish request invalid")
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
+	}
+
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()) + "/" + req.GetNodeId())
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume not found: %s", err)
+	}
+
+	var nodePrefix string
+	if volumeID.restrictAccess {
+		var ok bool
+		if nodePrefix, ok = nodePrefixFromID(req.GetNodeId()); !ok {
+			logger.V(2).Info("Node ID does not contain an IP address", "node_id", req.GetNodeId())
+			return nil, status.Errorf(codes.FailedPrecondition, "node %q does not report its IP address, which is required for volumes with restricted access", req.GetNodeId())
+		}
+
+		defer cs.publishLocks.Lock(volumeID.volume)()
+	}
+
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	volume := dynamicvolumev1.Volume{Identifier: volumeID.volume}
+	if err := engine.Get(ctx, &volume); err != nil {
+		logger.V(2).Error(err, "Failed to query volume", "id", req.GetVolumeId())
+		return nil, engineErrorToGRPC(err)
+	}
+
+	publishContext, err := volumeContextForVolume(ctx, engine, &volume, volumeID.storageServer, map[string]*dynamicvolumev1.StorageServerInterface{})
+	if err != nil {
+		logger.V(2).Error(err, "Failed to query storage server interface of volume", "id", req.GetVolumeId())
+		return nil, engineErrorToGRPC(err)
+	}
+
+	if publishContext == nil {
+		logger.V(2).Info("Mount URL of volume cannot be constructed yet", "id", req.GetVolumeId())
+		return nil, status.Errorf(codes.Unavailable, "Volume not ready yet, construction of mount URL was not possible")
+	}
+
+	resp := &csi.ControllerPublishVolumeResponse{
+		PublishContext: publishContext,
+	}
+
+	if !volumeID.restrictAccess {
+		logger.V(4).Info("Volume published successfully", "id", req.GetVolumeId())
+		return resp, nil
+	}
+
+	prefix, err := findOrCreatePrefix(ctx, engine, nodePrefix)
+	if err != nil {
+		logger.V(2).Error(err, "Failed to query prefix of node", "prefix", nodePrefix)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	denyAll, err := findPrefix(ctx, engine, denyAllPrefix)
+	if err != nil && !errors.Is(err, api.ErrNotFound) {
+		logger.V(2).Error(err, "Failed to query deny-all prefix", "prefix", denyAllPrefix)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	prefixes := volumePrefixIdentifiers(&volume)
+	if denyAll != nil && slices.Contains(prefixes, denyAll.Identifier) {
+		prefixes = slices.DeleteFunc(prefixes, func(identifier string) bool { return identifier == denyAll.Identifier })
+	} else if slices.Contains(prefixes, prefix.Identifier) {
+		logger.V(4).Info("Volume already published to node", "id", req.GetVolumeId(), "prefix", nodePrefix)
+		return resp, nil
+	}
+
+	if !slices.Contains(prefixes, prefix.Identifier) {
+		prefixes = append(prefixes, prefix.Identifier)
+	}
+
+	if err := updateVolumePrefixes(ctx, engine, volumeID.volume, prefixes); err != nil {
+		logger.V(2).Error(err, "Failed to add prefix to volume", "id", req.GetVolumeId(), "prefix", nodePrefix)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(2).Info("Volume published successfully", "id", req.GetVolumeId(), "prefix", nodePrefix)
+	return resp, nil
+}
+
+// ControllerUnpublishVolume revokes the access of the node to a volume with restricted
+// access, by removing the prefix containing the IP address of the node from the ADV volume.
+// The deny-all prefix takes its place when removing the last one, as the export would be
+// accessible by everyone without any prefix. Nothing is done for other volumes.
+func (cs *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Unpublishing volume", "id", req.GetVolumeId(), "node_id", req.GetNodeId())
+	if req.GetVolumeId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", ErrVolumeIDNotProvided)
+	}
+
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()) + "/" + req.GetNodeId())
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		logger.V(4).Info("Invalid volume ID, nothing to do", "id", req.GetVolumeId())
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	if !volumeID.restrictAccess {
+		logger.V(4).Info("Volume has no restricted access, nothing to do", "id", req.GetVolumeId())
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	nodePrefix, ok := nodePrefixFromID(req.GetNodeId())
+	if !ok {
+		// Without an IP address, the volume never got published to the node.
+		logger.V(4).Info("Node ID does not contain an IP address, nothing to do", "node_id", req.GetNodeId())
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	defer cs.publishLocks.Lock(volumeID.volume)()
+
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	volume := dynamicvolumev1.Volume{Identifier: volumeID.volume}
+	if err := engine.Get(ctx, &volume); err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			logger.V(4).Info("Volume does not exist anymore, nothing to do", "id", req.GetVolumeId())
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+
+		logger.V(2).Error(err, "Failed to query volume", "id", req.GetVolumeId())
+		return nil, engineErrorToGRPC(err)
+	}
+
+	prefix, err := findPrefix(ctx, engine, nodePrefix)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			logger.V(4).Info("Prefix of node does not exist, nothing to do", "prefix", nodePrefix)
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+
+		logger.V(2).Error(err, "Failed to query prefix of node", "prefix", nodePrefix)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	prefixes := volumePrefixIdentifiers(&volume)
+	if !slices.Contains(prefixes, prefix.Identifier) {
+		logger.V(4).Info("Volume not published to node, nothing to do", "id", req.GetVolumeId(), "prefix", nodePrefix)
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	prefixes = slices.DeleteFunc(prefixes, func(identifier string) bool { return identifier == prefix.Identifier })
+	if len(prefixes) == 0 {
+		denyAll, err := findOrCreatePrefix(ctx, engine, denyAllPrefix)
+		if err != nil {
+			logger.V(2).Error(err, "Failed to query deny-all prefix", "prefix", denyAllPrefix)
+			return nil, engineErrorToGRPC(err)
+		}
+		prefixes = []string{denyAll.Identifier}
+	}
+
+	if err := updateVolumePrefixes(ctx, engine, volumeID.volume, prefixes); err != nil {
+		logger.V(2).Error(err, "Failed to remove prefix from volume", "id", req.GetVolumeId(), "prefix", nodePrefix)
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(2).Info("Volume unpublished successfully", "id", req.GetVolumeId(), "prefix", nodePrefix)
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+func checkControllerPublishVolumeRequest(req *csi.ControllerPublishVolumeRequest) error {
+	if req.VolumeId == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if req.NodeId == "" {
+		return ErrNodeIDNotProvided
+	}
+
+	if req.VolumeCapability == nil {
+		return ErrVolumeCapabilityNotProvided
+	}
+
+	return checkVolumeCapabilities([]*csi.VolumeCapability{req.VolumeCapability})
+}
+
+// restrictAccessFromParameters parses the `csi.anx.io/restrict-access` StorageClass parameter.
+func restrictAccessFromParameters(parameters map[string]string) (bool, error) {
+	value, ok := parameters["csi.anx.io/restrict-access"]
+	if !ok {
+		return false, nil
+	}
+
+	restrictAccess, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for csi.anx.io/restrict-access: %w", err)
+	}
+
+	return restrictAccess, nil
+}
+
+// nodePrefixFromID returns the prefix containing only the IP address encoded into the node ID.
+func nodePrefixFromID(nodeID string) (string, bool) {
+	addr, ok := csitypes.NodeAddressFromID(nodeID)
+	if !ok {
+		return "", false
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), true
+}
+
+func findPrefix(ctx context.Context, engine types.API, nodePrefix string) (*dynamicvolumev1.Prefix, error) {
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.Prefix{Prefix: nodePrefix}, api.ObjectChannel(&channel)); err != nil {
+		return nil, fmt.Errorf("failed listing prefixes: %w", err)
+	}
+
+	for retriever := range channel {
+		var prefix dynamicvolumev1.Prefix
+		if err := retriever(&prefix); err != nil {
+			return nil, fmt.Errorf("failed retrieving prefix: %w", err)
+		}
+
+		if prefix.Prefix == nodePrefix {
+			return &prefix, nil
+		}
+	}
+
+	return nil, api.ErrNotFound
+}
+
+// findOrCreatePrefix returns the given ADV prefix, creating it if it doesn't exist yet.
+func findOrCreatePrefix(ctx context.Context, engine types.API, prefix string) (*dynamicvolumev1.Prefix, error) {
+	p, err := findPrefix(ctx, engine, prefix)
+	if errors.Is(err, api.ErrNotFound) {
+		return createPrefix(ctx, engine, prefix)
+	}
+
+	return p, err
+}
+
+func createPrefix(ctx context.Context, engine types.API, nodePrefix string) (*dynamicvolumev1.Prefix, error) {
+	logger := klog.FromContext(ctx)
+	prefix := dynamicvolumev1.Prefix{Prefix: nodePrefix}
+	logger.V(4).Info("Creating new ADV prefix", "prefix", nodePrefix)
+
+	if err := engine.Create(ctx, &prefix); err != nil {
+		return nil, fmt.Errorf("create prefix: %w", err)
+	}
+
+	if err := awaitCompletion(ctx, engine, &prefix); err != nil {
+		return nil, fmt.Errorf("failed awaiting completion of prefix: %w", err)
+	}
+
+	return &prefix, nil
+}
+
+func volumePrefixIdentifiers(volume *dynamicvolumev1.Volume) []string {
+	if volume.Prefixes == nil {
+		return []string{}
+	}
+
+	identifiers := make([]string, 0, len(*volume.Prefixes))
+	for _, prefix := range *volume.Prefixes {
+		identifiers = append(identifiers, prefix.Identifier)
+	}
+
+	return identifiers
+}
+
+func updateVolumePrefixes(ctx context.Context, engine types.API, volumeID string, prefixIdentifiers []string) error {
+	prefixes := make([]dynamicvolumev1.Prefix, 0, len(prefixIdentifiers))
+	for _, identifier := range prefixIdentifiers {
+		prefixes = append(prefixes, dynamicvolumev1.Prefix{Identifier: identifier})
+	}
+
+	volume := dynamicvolumev1.Volume{
+		Identifier: volumeID,
+		Prefixes:   &prefixes,
+	}
+
+	if err := engine.Update(ctx, &volume); err != nil {
+		return fmt.Errorf("update volume: %w", err)
+	}
+
+	if err := awaitCompletion(ctx, engine, &volume); err != nil {
+		if errors.Is(err, gs.ErrStateError) {
+			return status.Errorf(codes.Internal, "ADV volume went into error state while updating its prefixes")
+		}
+		return fmt.Errorf("failed awaiting completion: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller Service Publishing", func() {
+	var (
+		cs     *controller
+		engine *mockapi.MockAPI
+	)
+
+	BeforeEach(func() {
+		c := gomock.NewController(GinkgoT())
+		engine = mockapi.NewMockAPI(c)
+		cs = &controller{engine: engine}
+	})
+
+	// expectVolumeUpdate expects the prefixes of the volume to be updated to the given identifiers.
+	expectVolumeUpdate := func(prefixIdentifiers ...string) {
+		prefixes := []dynamicvolumev1.Prefix{}
+		for _, identifier := range prefixIdentifiers {
+			prefixes = append(prefixes, dynamicvolumev1.Prefix{Identifier: identifier})
+		}
+
+		engine.EXPECT().Update(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "volume", Prefixes: &prefixes})
+
+		// AwaitCompletion
+		engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+			v.State.Type = gs.StateTypeOK
+			return nil
+		})
+	}
+
+	expectVolumeGet := func(prefixIdentifiers ...string) {
+		engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "volume"}).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+			prefixes := []dynamicvolumev1.Prefix{}
+			for _, identifier := range prefixIdentifiers {
+				prefixes = append(prefixes, dynamicvolumev1.Prefix{Identifier: identifier})
+			}
+			v.Prefixes = &prefixes
+			v.Path = "/volume"
+			v.StorageServerInterfaces = &[]dynamicvolumev1.StorageServerInterface{{Identifier: "old-storage-server"}}
+			return nil
+		})
+	}
+
+	// expectPrefixList expects the given prefix to be looked up, returning the given prefixes.
+	expectPrefixList := func(prefix string, prefixes ...dynamicvolumev1.Prefix) {
+		engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Prefix{Prefix: prefix}, gomock.Any()).DoAndReturn(listReturning(prefixes...))
+	}
+
+	expectStorageServerGet := func() {
+		engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+			s.IPAddress.Name = "1.2.3.4"
+			return nil
+		})
+	}
+
+	Context("ControllerPublishVolume", func() {
+		var validRequest *csi.ControllerPublishVolumeRequest
+
+		BeforeEach(func() {
+			validRequest = &csi.ControllerPublishVolumeRequest{
+				VolumeId:         "v1:volume:storage-server:restricted",
+				NodeId:           "node@10.0.0.5",
+				VolumeCapability: &csi.VolumeCapability{},
+			}
+		})
+
+		It("only resolves the mount URL for volumes without restricted access", func() {
+			validRequest.VolumeId = "v1:volume:storage-server"
+			expectVolumeGet()
+			expectStorageServerGet()
+
+			resp, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.PublishContext).To(Equal(map[string]string{"mountURL": "1.2.3.4:/volume"}))
+		})
+
+		It("uses the first storage server interface of the volume for legacy volume IDs", func() {
+			validRequest.VolumeId = "volume"
+			expectVolumeGet()
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "old-storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "5.6.7.8"
+				return nil
+			})
+
+			resp, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.PublishContext).To(Equal(map[string]string{"mountURL": "5.6.7.8:/volume"}))
+		})
+
+		It("returns a NotFound error for invalid volume IDs", func() {
+			validRequest.VolumeId = "v2:volume:storage-server"
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+
+		It("adds the existing prefix of the node to the volume", func() {
+			expectVolumeGet("other-prefix")
+			expectStorageServerGet()
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+			expectPrefixList(denyAllPrefix)
+			expectVolumeUpdate("other-prefix", "node-prefix")
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("replaces the deny-all prefix of the volume", func() {
+			expectVolumeGet("deny-all")
+			expectStorageServerGet()
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+			expectPrefixList(denyAllPrefix, dynamicvolumev1.Prefix{Identifier: "deny-all", Prefix: denyAllPrefix})
+			expectVolumeUpdate("node-prefix")
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("creates the prefix of the node if it does not exist yet", func() {
+			expectVolumeGet()
+			expectStorageServerGet()
+			expectPrefixList("10.0.0.5/32")
+			engine.EXPECT().Create(gomock.Any(), &dynamicvolumev1.Prefix{Prefix: "10.0.0.5/32"}).DoAndReturn(func(_ any, p *dynamicvolumev1.Prefix, _ ...any) error {
+				p.Identifier = "node-prefix"
+				return nil
+			})
+			// AwaitCompletion
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, p *dynamicvolumev1.Prefix, _ ...any) error {
+				p.State.Type = gs.StateTypeOK
+				return nil
+			})
+			expectPrefixList(denyAllPrefix)
+			expectVolumeUpdate("node-prefix")
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not update the volume if it's already published to the node", func() {
+			expectVolumeGet("node-prefix")
+			expectStorageServerGet()
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+			expectPrefixList(denyAllPrefix, dynamicvolumev1.Prefix{Identifier: "deny-all", Prefix: denyAllPrefix})
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns a FailedPrecondition error if the node ID contains no IP address", func() {
+			validRequest.NodeId = "node"
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		})
+
+		It("returns a NotFound error if the volume does not exist", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).Return(api.NewHTTPError(404, "GET", nil, nil))
+
+			_, err := cs.ControllerPublishVolume(context.TODO(), validRequest)
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+
+		It("returns an InvalidArgument error when request check failed", func() {
+			_, err := cs.ControllerPublishVolume(context.TODO(), &csi.ControllerPublishVolumeRequest{VolumeId: "volume"})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("ControllerUnpublishVolume", func() {
+		var validRequest *csi.ControllerUnpublishVolumeRequest
+
+		BeforeEach(func() {
+			validRequest = &csi.ControllerUnpublishVolumeRequest{
+				VolumeId: "v1:volume:storage-server:restricted",
+				NodeId:   "node@10.0.0.5",
+			}
+		})
+
+		It("removes the prefix of the node from the volume", func() {
+			expectVolumeGet("other-prefix", "node-prefix")
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+			expectVolumeUpdate("other-prefix")
+
+			_, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("replaces the last prefix with the deny-all prefix", func() {
+			expectVolumeGet("node-prefix")
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+			expectPrefixList(denyAllPrefix, dynamicvolumev1.Prefix{Identifier: "deny-all", Prefix: denyAllPrefix})
+			expectVolumeUpdate("deny-all")
+
+			_, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does nothing if the volume is not published to the node", func() {
+			expectVolumeGet("other-prefix")
+			expectPrefixList("10.0.0.5/32", dynamicvolumev1.Prefix{Identifier: "node-prefix", Prefix: "10.0.0.5/32"})
+
+			_, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("succeeds if the volume does not exist anymore", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).Return(api.ErrNotFound)
+
+			_, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not call the Engine for volumes without restricted access", func() {
+			// no calls are expected on the engine mock, so any call fails the spec
+			for _, id := range []string{"v1:volume:storage-server", "v1:volume:storage-server:0123456789abcdef", "volume"} {
+				validRequest.VolumeId = id
+
+				resp, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp).To(Equal(&csi.ControllerUnpublishVolumeResponse{}))
+			}
+		})
+
+		It("does nothing for nodes without IP address", func() {
+			validRequest.NodeId = "node"
+
+			resp, err := cs.ControllerUnpublishVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp).To(Equal(&csi.ControllerUnpublishVolumeResponse{}))
+		})
+	})
+
+	DescribeTable("nodePrefixFromID",
+		func(nodeID, expectedPrefix string, expectedOK bool) {
+			prefix, ok := nodePrefixFromID(nodeID)
+			Expect(ok).To(Equal(expectedOK))
+			Expect(prefix).To(Equal(expectedPrefix))
+		},
+		Entry("IPv4", "node@10.0.0.5", "10.0.0.5/32", true),
+		Entry("IPv6", "node@2001:db8::1", "2001:db8::1/128", true),
+		Entry("without IP address", "node", "", false),
+		Entry("invalid IP address", "node@foo", "", false),
+	)
+
+	DescribeTable("restrictAccessFromParameters",
+		func(parameters map[string]string, expected bool, expectError bool) {
+			restrictAccess, err := restrictAccessFromParameters(parameters)
+			if expectError {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(restrictAccess).To(Equal(expected))
+		},
+		Entry("not set", map[string]string{}, false, false),
+		Entry("enabled", map[string]string{"csi.anx.io/restrict-access": "true"}, true, false),
+		Entry("disabled", map[string]string{"csi.anx.io/restrict-access": "false"}, false, false),
+		Entry("invalid", map[string]string{"csi.anx.io/restrict-access": "foo"}, false, true),
+	)
+})
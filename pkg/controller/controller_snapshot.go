@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/internal/redact"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/klog/v2"
+)
+
+// CreateSnapshot creates a point-in-time copy of an existing ADV volume.
+//
+// The call blocks until the Engine reports the snapshot as completed, therefore
+// snapshots are always returned as ready to use.
+func (cs *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Creating new snapshot", "name", req.GetName(), "source_volume_id", req.GetSourceVolumeId())
+	if err := checkCreateSnapshotRequest(req); err != nil {
+		logger.V(2).Error(err, "Snapshot request validation failed", "request", redact.Secrets(req))
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
+	}
+
+	done, err := cs.inflight.Start(inflight.SnapshotKey(req.GetName()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	engine, err := cs.engineForSecrets(req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	snapshot, err := createAnexiaSnapshotFromRequest(ctx, engine, req)
+	if err != nil {
+		logger.V(2).Error(err, "Snapshot creation in Anexia Engine failed")
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(4).Info("Snapshot successfully created", "id", snapshot.Identifier)
+	csiSnapshot := csiSnapshotFromAnexiaSnapshot(snapshot)
+	csiSnapshot.SourceVolumeId = req.GetSourceVolumeId()
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: csiSnapshot,
+	}, nil
+}
+
+func (cs *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Deleting snapshot", "id", req.GetSnapshotId())
+	if err := checkDeleteSnapshotRequest(req); err != nil {
+		logger.V(4).Error(err, "Snapshot request invalid", "request", redact.Secrets(req))
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
+	}
+
+	done, err := cs.inflight.Start(inflight.SnapshotKey(req.GetSnapshotId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	engine, err := cs.engineForSecrets(req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	logger.V(4).Info("Deleting ADV snapshot in Anexia Engine")
+	if err := engine.Destroy(ctx, &dynamicvolumev1.Snapshot{Identifier: req.GetSnapshotId()}); api.IgnoreNotFound(err) != nil {
+		logger.V(2).Error(err, "Snapshot deletion failed")
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(2).Info("Snapshot successfully deleted")
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots returns the snapshots known to the Engine, optionally filtered by
+// snapshot or source volume ID. Paging is done with an offset encoded in the tokens.
+func (cs *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info("Listing snapshots", "snapshot_id", req.GetSnapshotId(), "source_volume_id", req.GetSourceVolumeId())
+
+	engine, err := cs.engineForSecrets(req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	snapshots, err := listAnexiaSnapshots(ctx, engine, req)
+	if err != nil {
+		logger.V(2).Error(err, "Listing snapshots failed")
+		return nil, engineErrorToGRPC(err)
+	}
+
+	start, end, nextToken, err := paginate(len(snapshots), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		logger.V(2).Error(err, "Invalid starting token", "starting_token", req.GetStartingToken())
+		return nil, status.Errorf(codes.Aborted, "invalid starting token: %s", err)
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, end-start)
+	for _, snapshot := range snapshots[start:end] {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: csiSnapshotFromAnexiaSnapshot(snapshot),
+		})
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+func checkCreateSnapshotRequest(req *csi.CreateSnapshotRequest) error {
+	if req.Name == "" {
+		return ErrNameNotProvided
+	}
+
+	if req.SourceVolumeId == "" {
+		return ErrSourceVolumeIDNotProvided
+	}
+
+	return nil
+}
+
+func checkDeleteSnapshotRequest(req *csi.DeleteSnapshotRequest) error {
+	if req.SnapshotId == "" {
+		return ErrSnapshotIDNotProvided
+	}
+
+	return nil
+}
+
+func createAnexiaSnapshotFromRequest(ctx context.Context, engine types.API, req *csi.CreateSnapshotRequest) (*dynamicvolumev1.Snapshot, error) {
+	logger := klog.FromContext(ctx)
+	sourceVolumeID, err := parseVolumeID(req.GetSourceVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "source volume not found: %s", err)
+	}
+
+	snapshot := dynamicvolumev1.Snapshot{
+		Name:   req.GetName(),
+		Volume: &dynamicvolumev1.Volume{Identifier: sourceVolumeID.volume},
+	}
+	logger.V(4).Info("Creating new ADV snapshot", "snapshot", snapshot)
+
+	if err := engine.Create(ctx, &snapshot); err != nil {
+		httpError := api.HTTPError{}
+		if errors.As(err, &httpError) && httpError.StatusCode() == http.StatusUnprocessableEntity {
+			logger.V(4).Info("Snapshot already exists at engine", "name", req.GetName())
+			return handleSnapshotIdempotency(ctx, engine, req, sourceVolumeID.volume)
+		}
+
+		if errors.Is(err, api.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "source volume not found: %s", err)
+		}
+
+		return nil, fmt.Errorf("create snapshot: %w", err)
+	}
+
+	logger.V(4).Info("ADV snapshot created, awaiting completion", "engine_identifier", snapshot.Identifier)
+	if err := awaitCompletion(ctx, engine, &snapshot); err != nil {
+		switch {
+		case errors.Is(err, gs.ErrStateError):
+			logger.V(2).Info("ADV snapshot went into error state, deleting it", "engine_identifier", snapshot.Identifier)
+			if err := engine.Destroy(ctx, &snapshot); err != nil {
+				logger.V(2).Error(err, "Faulty ADV snapshot could not be deleted", "engine_identifier", snapshot.Identifier)
+				return nil, fmt.Errorf("ADV snapshot deletion of faulty snapshot failed: %w", err)
+			}
+
+			// Same as for volumes, the next call to CreateSnapshot will retry it.
+			return nil, status.Errorf(codes.FailedPrecondition, "ADV snapshot went into error state, recreating it")
+		default:
+			return nil, fmt.Errorf("failed awaiting completion: %w", err)
+		}
+	}
+
+	return &snapshot, nil
+}
+
+func handleSnapshotIdempotency(ctx context.Context, engine types.API, req *csi.CreateSnapshotRequest, sourceVolume string) (*dynamicvolumev1.Snapshot, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Searching for existing snapshot with same name", "name", req.GetName())
+	original, err := findSnapshotByName(ctx, engine, req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed finding original: %s", err)
+	}
+
+	logger.V(4).Info("Existing snapshot found, comparing values", "name", req.GetName(), "engine_identifier", original.Identifier)
+	if original.Volume == nil || original.Volume.Identifier != sourceVolume {
+		logger.V(4).Info("A snapshot with the same name, but a different source volume already exists at the Anexia Engine")
+		return nil, status.Error(codes.AlreadyExists, "snapshot with same name already exists")
+	}
+
+	logger.V(4).Info("Waiting for snapshot to transition into completion")
+	if err := awaitCompletion(ctx, engine, original); err != nil {
+		logger.V(2).Error(err, "Snapshot did not transition into completion")
+		return nil, fmt.Errorf("failed awaiting completion: %w", err)
+	}
+
+	return original, nil
+}
+
+func findSnapshotByName(ctx context.Context, engine types.API, name string) (*dynamicvolumev1.Snapshot, error) {
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.Snapshot{Name: name}, api.ObjectChannel(&channel)); err != nil {
+		return nil, fmt.Errorf("failed listing snapshots: %s", err)
+	}
+
+	var listResult dynamicvolumev1.Snapshot
+
+	for retriever := range channel {
+		if err := retriever(&listResult); err != nil {
+			return nil, fmt.Errorf("failed retrieving snapshot: %s", err)
+		}
+
+		if listResult.Name == name {
+			if err := engine.Get(ctx, &listResult); err != nil {
+				return nil, fmt.Errorf("failed retrieving full snapshot object: %w", err)
+			}
+
+			return &listResult, nil
+		}
+	}
+
+	return nil, api.ErrNotFound
+}
+
+// listAnexiaSnapshots returns all snapshots matching the filters of the given request,
+// sorted by their identifier to have a stable order for paging.
+func listAnexiaSnapshots(ctx context.Context, engine types.API, req *csi.ListSnapshotsRequest) ([]*dynamicvolumev1.Snapshot, error) {
+	var sourceVolume string
+	if req.GetSourceVolumeId() != "" {
+		sourceVolumeID, err := parseVolumeID(req.GetSourceVolumeId())
+		if err != nil {
+			// there cannot be any snapshots of a volume with an invalid ID
+			return nil, nil
+		}
+
+		sourceVolume = sourceVolumeID.volume
+	}
+
+	if req.GetSnapshotId() != "" {
+		snapshot := dynamicvolumev1.Snapshot{Identifier: req.GetSnapshotId()}
+		if err := engine.Get(ctx, &snapshot); err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		if !snapshotMatchesSourceVolume(&snapshot, sourceVolume) {
+			return nil, nil
+		}
+
+		return []*dynamicvolumev1.Snapshot{&snapshot}, nil
+	}
+
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.Snapshot{}, api.ObjectChannel(&channel), api.FullObjects(true)); err != nil {
+		return nil, fmt.Errorf("failed listing snapshots: %w", err)
+	}
+
+	var snapshots []*dynamicvolumev1.Snapshot
+	for retriever := range channel {
+		var snapshot dynamicvolumev1.Snapshot
+		if err := retriever(&snapshot); err != nil {
+			return nil, fmt.Errorf("failed retrieving snapshot: %w", err)
+		}
+
+		if snapshotMatchesSourceVolume(&snapshot, sourceVolume) {
+			snapshots = append(snapshots, &snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Identifier < snapshots[j].Identifier
+	})
+
+	return snapshots, nil
+}
+
+func snapshotMatchesSourceVolume(snapshot *dynamicvolumev1.Snapshot, sourceVolumeID string) bool {
+	if sourceVolumeID == "" {
+		return true
+	}
+
+	return snapshot.Volume != nil && snapshot.Volume.Identifier == sourceVolumeID
+}
+
+func csiSnapshotFromAnexiaSnapshot(snapshot *dynamicvolumev1.Snapshot) *csi.Snapshot {
+	// The creation time is required by the CSI spec, so we fall back to the current
+	// time if the Engine did not return one.
+	creationTime := timestamppb.Now()
+	if snapshot.CreatedAt != nil {
+		creationTime = timestamppb.New(*snapshot.CreatedAt)
+	}
+
+	var sourceVolumeID string
+	if snapshot.Volume != nil {
+		sourceVolumeID = snapshot.Volume.Identifier
+	}
+
+	return &csi.Snapshot{
+		SnapshotId:     snapshot.Identifier,
+		SourceVolumeId: sourceVolumeID,
+		SizeBytes:      snapshot.Size,
+		CreationTime:   creationTime,
+		ReadyToUse:     snapshot.State.Type == gs.StateTypeOK,
+	}
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// listReturning returns a function usable with DoAndReturn for mocked List calls,
+// which sends the given objects through the object channel passed as list option.
+func listReturning[T any](objects ...T) func(context.Context, types.FilterObject, ...types.ListOption) error {
+	return func(_ context.Context, _ types.FilterObject, opts ...types.ListOption) error {
+		options := types.ListOptions{}
+		for _, opt := range opts {
+			if err := opt.ApplyToList(&options); err != nil {
+				return err
+			}
+		}
+
+		if options.ObjectChannel == nil {
+			return errors.New("list called without object channel")
+		}
+
+		c := make(chan types.ObjectRetriever, len(objects))
+		*options.ObjectChannel = c
+		for _, object := range objects {
+			c <- func(o types.Object) error {
+				reflect.ValueOf(o).Elem().Set(reflect.ValueOf(object))
+				return nil
+			}
+		}
+		close(c)
+
+		return nil
+	}
+}
+
+var _ = Describe("Controller Service Snapshots", func() {
+	var (
+		cs     *controller
+		engine *mockapi.MockAPI
+	)
+
+	BeforeEach(func() {
+		c := gomock.NewController(GinkgoT())
+		engine = mockapi.NewMockAPI(c)
+		cs = &controller{engine: engine}
+	})
+
+	Context("CreateSnapshot", func() {
+		var validRequest *csi.CreateSnapshotRequest
+
+		BeforeEach(func() {
+			validRequest = &csi.CreateSnapshotRequest{
+				Name:           "snap",
+				SourceVolumeId: "source-volume",
+			}
+		})
+
+		It("can create snapshots", func() {
+			createdAt := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+
+			engine.EXPECT().Create(gomock.Any(), &dynamicvolumev1.Snapshot{
+				Name:   "snap",
+				Volume: &dynamicvolumev1.Volume{Identifier: "source-volume"},
+			}).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+				s.Identifier = "snapshot-identifier"
+				return nil
+			})
+
+			// AwaitCompletion
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+				s.State.Type = gs.StateTypeOK
+				s.Size = 12345
+				s.CreatedAt = &createdAt
+				return nil
+			})
+
+			resp, err := cs.CreateSnapshot(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Snapshot.SnapshotId).To(Equal("snapshot-identifier"))
+			Expect(resp.Snapshot.SourceVolumeId).To(Equal("source-volume"))
+			Expect(resp.Snapshot.SizeBytes).To(Equal(int64(12345)))
+			Expect(resp.Snapshot.CreationTime.AsTime()).To(Equal(createdAt))
+			Expect(resp.Snapshot.ReadyToUse).To(BeTrue())
+		})
+
+		It("returns an InvalidArgument error when request check failed", func() {
+			resp, err := cs.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{Name: "snap"})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(resp).To(BeNil())
+		})
+
+		It("returns a NotFound error when the source volume does not exist", func() {
+			engine.EXPECT().Create(gomock.Any(), gomock.Any()).Return(api.ErrNotFound)
+
+			resp, err := cs.CreateSnapshot(context.TODO(), validRequest)
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(resp).To(BeNil())
+		})
+
+		Context("idempotency", func() {
+			BeforeEach(func() {
+				engine.EXPECT().Create(gomock.Any(), gomock.Any()).Return(api.NewHTTPError(http.StatusUnprocessableEntity, "POST", nil, nil))
+				engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Snapshot{Name: "snap"}, gomock.Any()).
+					DoAndReturn(listReturning(dynamicvolumev1.Snapshot{Identifier: "original", Name: "snap"}))
+			})
+
+			It("returns the original if a snapshot with the same name and source already exists", func() {
+				// retrieve full object
+				engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+					s.Volume = &dynamicvolumev1.Volume{Identifier: "source-volume"}
+					return nil
+				})
+
+				// AwaitCompletion
+				engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+					s.State.Type = gs.StateTypeOK
+					return nil
+				})
+
+				resp, err := cs.CreateSnapshot(context.TODO(), validRequest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.Snapshot.SnapshotId).To(Equal("original"))
+			})
+
+			It("returns an AlreadyExists error if the existing snapshot has a different source", func() {
+				engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+					s.Volume = &dynamicvolumev1.Volume{Identifier: "other-volume"}
+					return nil
+				})
+
+				resp, err := cs.CreateSnapshot(context.TODO(), validRequest)
+				Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+				Expect(resp).To(BeNil())
+			})
+		})
+	})
+
+	Context("DeleteSnapshot", func() {
+		It("can delete snapshots", func() {
+			engine.EXPECT().Destroy(gomock.Any(), &dynamicvolumev1.Snapshot{Identifier: "snapshot-identifier"})
+
+			resp, err := cs.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "snapshot-identifier"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp).ToNot(BeNil())
+		})
+
+		It("succeeds if the snapshot does not exist anymore", func() {
+			engine.EXPECT().Destroy(gomock.Any(), gomock.Any()).Return(api.ErrNotFound)
+
+			_, err := cs.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{SnapshotId: "snapshot-identifier"})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns an InvalidArgument error when request check failed", func() {
+			resp, err := cs.DeleteSnapshot(context.TODO(), &csi.DeleteSnapshotRequest{})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(resp).To(BeNil())
+		})
+	})
+
+	Context("ListSnapshots", func() {
+		snapshots := []dynamicvolumev1.Snapshot{
+			{Identifier: "c", Volume: &dynamicvolumev1.Volume{Identifier: "volume-1"}},
+			{Identifier: "a", Volume: &dynamicvolumev1.Volume{Identifier: "volume-1"}},
+			{Identifier: "b", Volume: &dynamicvolumev1.Volume{Identifier: "volume-2"}},
+		}
+
+		snapshotIDs := func(resp *csi.ListSnapshotsResponse) []string {
+			ids := make([]string, 0, len(resp.Entries))
+			for _, entry := range resp.Entries {
+				ids = append(ids, entry.Snapshot.SnapshotId)
+			}
+			return ids
+		}
+
+		It("lists all snapshots in a stable order", func() {
+			engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(listReturning(snapshots...))
+
+			resp, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs(resp)).To(Equal([]string{"a", "b", "c"}))
+			Expect(resp.NextToken).To(BeEmpty())
+		})
+
+		It("filters snapshots by source volume", func() {
+			engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(listReturning(snapshots...))
+
+			resp, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{SourceVolumeId: "volume-1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs(resp)).To(Equal([]string{"a", "c"}))
+		})
+
+		It("pages through the snapshots", func() {
+			engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(listReturning(snapshots...)).Times(2)
+
+			resp, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{MaxEntries: 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs(resp)).To(Equal([]string{"a", "b"}))
+			Expect(resp.NextToken).To(Equal("2"))
+
+			resp, err = cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{MaxEntries: 2, StartingToken: resp.NextToken})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs(resp)).To(Equal([]string{"c"}))
+			Expect(resp.NextToken).To(BeEmpty())
+		})
+
+		It("returns an Aborted error for invalid starting tokens", func() {
+			engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(listReturning(snapshots...))
+
+			_, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{StartingToken: "foo"})
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+		})
+
+		It("returns a single snapshot when filtered by ID", func() {
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Snapshot{Identifier: "a"}).Return(nil)
+
+			resp, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{SnapshotId: "a"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs(resp)).To(Equal([]string{"a"}))
+		})
+
+		It("returns an empty list if the requested snapshot does not exist", func() {
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Snapshot{Identifier: "d"}).Return(api.ErrNotFound)
+
+			resp, err := cs.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{SnapshotId: "d"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Entries).To(BeEmpty())
+		})
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
 	"github.com/anexia/csi-driver/pkg/internal/mockapi"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
@@ -88,10 +89,36 @@ var _ = Describe("Controller Service", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res).ToNot(BeNil())
 
-			Expect(res.Volume.VolumeId).To(Equal(testVolumeIdentifier))
+			Expect(res.Volume.VolumeId).To(Equal("v1:" + testVolumeIdentifier + ":" + testStorageServerIdentifier))
 			Expect(res.Volume.VolumeContext["mountURL"]).To(Equal("mock-storage-server.anx.io:/foo/bar/baz"))
 		})
 
+		It("creates volumes with restricted access with the deny-all prefix", func() {
+			validRequest.Parameters["csi.anx.io/restrict-access"] = "true"
+
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: testStorageServerIdentifier}).DoAndReturn(func(_ any, v *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				v.IPAddress = dynamicvolumev1.IPAddress{Name: "mock-storage-server.anx.io"}
+				return nil
+			})
+			engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Prefix{Prefix: denyAllPrefix}, gomock.Any()).
+				DoAndReturn(listReturning(dynamicvolumev1.Prefix{Identifier: "deny-all", Prefix: denyAllPrefix}))
+			engine.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				Expect(v.Prefixes).To(Equal(&[]dynamicvolumev1.Prefix{{Identifier: "deny-all"}}))
+				v.Identifier = "test-identifier"
+				v.Path = "/foo/bar/baz"
+				return nil
+			})
+			// AwaitCompletion
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				v.State.Type = gs.StateTypeOK
+				return nil
+			})
+
+			res, err := cs.CreateVolume(context.TODO(), validRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Volume.VolumeId).To(Equal("v1:test-identifier:" + testStorageServerIdentifier + ":restricted"))
+		})
+
 		It("returns an InvalidArgument error when request check failed", func() {
 			// empty CreateVolumeRequest is not valid
 			resp, err := cs.CreateVolume(context.TODO(), &csi.CreateVolumeRequest{})
@@ -145,6 +172,49 @@ var _ = Describe("Controller Service", func() {
 			Expect(resp).To(BeNil())
 		})
 
+		It("returns an Aborted error when an operation on the volume is in progress", func() {
+			done, err := cs.inflight.Start(inflight.VolumeKey("test-identifier"))
+			Expect(err).ToNot(HaveOccurred())
+			defer done()
+
+			_, err = cs.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{
+				VolumeId: "test-identifier",
+			})
+
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+		})
+
+		It("rejects concurrent requests on the same volume until it is deleted", func() {
+			destroying := make(chan struct{})
+			release := make(chan struct{})
+			engine.EXPECT().Destroy(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "test-identifier"}).DoAndReturn(func(_ any, _ any, _ ...any) error {
+				close(destroying)
+				<-release
+				return nil
+			})
+
+			deleted := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				_, err := cs.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: "test-identifier"})
+				deleted <- err
+			}()
+			Eventually(destroying).Should(BeClosed())
+
+			_, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "test-identifier"})
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "other-identifier"}).Return(api.NewHTTPError(404, "GET", nil, nil))
+			_, err = cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "other-identifier"})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+
+			close(release)
+			Eventually(deleted).Should(Receive(BeNil()))
+
+			_, err = cs.inflight.Start(inflight.VolumeKey("test-identifier"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
 		It("returns a Internal error when the volume couldn't be deleted", func() {
 			testVolumeIdentifier := "test-identifier"
 
@@ -159,6 +229,20 @@ var _ = Describe("Controller Service", func() {
 		})
 	})
 
+	Context("ControllerGetCapabilities", func() {
+		It("advertises ListVolumes without the published nodes of volumes", func() {
+			resp, err := cs.ControllerGetCapabilities(context.TODO(), &csi.ControllerGetCapabilitiesRequest{})
+			Expect(err).ToNot(HaveOccurred())
+
+			var types []csi.ControllerServiceCapability_RPC_Type
+			for _, capability := range resp.GetCapabilities() {
+				types = append(types, capability.GetRpc().GetType())
+			}
+			Expect(types).To(ContainElement(csi.ControllerServiceCapability_RPC_LIST_VOLUMES))
+			Expect(types).ToNot(ContainElement(csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES))
+		})
+	})
+
 	Context("ValidateVolumeCapabilitiesRequest", func() {
 		It("returns an InvalidArgument error when request check failed", func() {
 			// an empty ValidateVolumeCapabilitiesRequest is not valid
@@ -200,18 +284,182 @@ var _ = Describe("Controller Service", func() {
 	})
 
 	Context("ControllerPublishVolume", func() {
-		It("returns an empty response without any errors", func() {
-			resp, err := cs.ControllerPublishVolume(context.TODO(), &csi.ControllerPublishVolumeRequest{})
+		It("returns the mount URL without any errors", func() {
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "volume"}).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				v.Path = "/volume"
+				return nil
+			})
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "1.2.3.4"
+				return nil
+			})
+
+			resp, err := cs.ControllerPublishVolume(context.TODO(), &csi.ControllerPublishVolumeRequest{
+				VolumeId:         "v1:volume:storage-server",
+				NodeId:           "node",
+				VolumeCapability: &csi.VolumeCapability{},
+			})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(resp).To(Equal(&csi.ControllerPublishVolumeResponse{}))
+			Expect(resp).To(Equal(&csi.ControllerPublishVolumeResponse{PublishContext: map[string]string{"mountURL": "1.2.3.4:/volume"}}))
 		})
 	})
 
 	Context("ControllerUnpublishVolume", func() {
 		It("returns an empty response without any errors", func() {
-			resp, err := cs.ControllerUnpublishVolume(context.TODO(), &csi.ControllerUnpublishVolumeRequest{})
+			resp, err := cs.ControllerUnpublishVolume(context.TODO(), &csi.ControllerUnpublishVolumeRequest{VolumeId: "volume", NodeId: "node"})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(resp).To(Equal(&csi.ControllerUnpublishVolumeResponse{}))
 		})
 	})
+
+	Context("ListVolumes", func() {
+		volumes := []dynamicvolumev1.Volume{
+			{
+				Identifier:              "b",
+				Size:                    12345,
+				Path:                    "/b",
+				StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}},
+			},
+			{
+				Identifier:              "a",
+				Size:                    54321,
+				Path:                    "/a",
+				StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}},
+			},
+			{
+				// still provisioning, no path yet
+				Identifier:              "c",
+				StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}},
+			},
+		}
+
+		BeforeEach(func() {
+			engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Volume{}, gomock.Any()).DoAndReturn(listReturning(volumes...))
+		})
+
+		It("lists all volumes with their mount URL", func() {
+			// the storage server is only queried once
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "1.2.3.4"
+				return nil
+			})
+
+			resp, err := cs.ListVolumes(context.TODO(), &csi.ListVolumesRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.NextToken).To(BeEmpty())
+			Expect(resp.Entries).To(HaveLen(3))
+
+			Expect(resp.Entries[0].Volume.VolumeId).To(Equal("v1:a:storage-server"))
+			Expect(resp.Entries[0].Volume.CapacityBytes).To(Equal(int64(54321)))
+			Expect(resp.Entries[0].Volume.VolumeContext).To(HaveKeyWithValue("mountURL", "1.2.3.4:/a"))
+			Expect(resp.Entries[1].Volume.VolumeId).To(Equal("v1:b:storage-server"))
+			Expect(resp.Entries[1].Volume.VolumeContext).To(HaveKeyWithValue("mountURL", "1.2.3.4:/b"))
+			Expect(resp.Entries[2].Volume.VolumeId).To(Equal("v1:c:storage-server"))
+			Expect(resp.Entries[2].Volume.VolumeContext).To(BeEmpty())
+		})
+
+		It("pages through the volumes", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "1.2.3.4"
+				return nil
+			})
+
+			resp, err := cs.ListVolumes(context.TODO(), &csi.ListVolumesRequest{MaxEntries: 1, StartingToken: "1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Entries).To(HaveLen(1))
+			Expect(resp.Entries[0].Volume.VolumeId).To(Equal("v1:b:storage-server"))
+			Expect(resp.NextToken).To(Equal("2"))
+		})
+
+		It("lists the volumes of tokens from secrets with a reference to the token", func() {
+			secretsEngine := mockapi.NewMockAPI(gomock.NewController(GinkgoT()))
+			cs.engines = map[string]api.API{"0123456789abcdef": secretsEngine}
+
+			secretsEngine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Volume{}, gomock.Any()).DoAndReturn(listReturning(
+				volumes[1],
+				dynamicvolumev1.Volume{
+					Identifier:              "d",
+					Path:                    "/d",
+					StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}},
+				},
+			))
+			secretsEngine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "1.2.3.4"
+				return nil
+			})
+
+			resp, err := cs.ListVolumes(context.TODO(), &csi.ListVolumesRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Entries).To(HaveLen(4))
+			Expect(resp.Entries[0].Volume.VolumeId).To(Equal("v1:a:storage-server:0123456789abcdef"))
+			Expect(resp.Entries[1].Volume.VolumeId).To(Equal("v1:b:storage-server"))
+			Expect(resp.Entries[3].Volume.VolumeId).To(Equal("v1:d:storage-server:0123456789abcdef"))
+		})
+
+		It("returns an Aborted error for invalid starting tokens", func() {
+			_, err := cs.ListVolumes(context.TODO(), &csi.ListVolumesRequest{StartingToken: "10"})
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+		})
+
+		It("returns an error when the storage server interface couldn't be retrieved", func() {
+			engine.EXPECT().Get(gomock.Any(), gomock.Any()).Return(api.NewHTTPError(500, "GET", nil, nil))
+
+			_, err := cs.ListVolumes(context.TODO(), &csi.ListVolumesRequest{})
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+
+	Context("ControllerGetVolume", func() {
+		It("returns the volume with its condition", func() {
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "foo"}).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				v.Size = 12345
+				v.Path = "/foo"
+				v.Error = "disk on fire"
+				v.StorageServerInterfaces = &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}}
+				return nil
+			})
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+				s.IPAddress.Name = "1.2.3.4"
+				return nil
+			})
+
+			resp, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "foo"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Volume.VolumeId).To(Equal("foo"))
+			Expect(resp.Volume.CapacityBytes).To(Equal(int64(12345)))
+			Expect(resp.Volume.VolumeContext).To(HaveKeyWithValue("mountURL", "1.2.3.4:/foo"))
+			Expect(resp.Status.VolumeCondition.Abnormal).To(BeTrue())
+		})
+
+		It("returns an InvalidArgument error when no volume id was provided", func() {
+			resp, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(resp).To(BeNil())
+		})
+
+		It("returns a NotFound error when the volume doesn't exist", func() {
+			engine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "foo"}).Return(api.NewHTTPError(404, "GET", nil, nil))
+
+			resp, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "foo"})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(resp).To(BeNil())
+		})
+
+		It("queries volumes with the token referenced in their ID", func() {
+			secretsEngine := mockapi.NewMockAPI(gomock.NewController(GinkgoT()))
+			cs.engines = map[string]api.API{"0123456789abcdef": secretsEngine}
+
+			secretsEngine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "foo"}).Return(nil)
+			secretsEngine.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "storage-server"}).Return(nil)
+
+			resp, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "v1:foo:storage-server:0123456789abcdef"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Volume.VolumeId).To(Equal("v1:foo:storage-server:0123456789abcdef"))
+		})
+
+		It("returns a FailedPrecondition error for volumes of unknown tokens", func() {
+			_, err := cs.ControllerGetVolume(context.TODO(), &csi.ControllerGetVolumeRequest{VolumeId: "v1:foo:storage-server:0123456789abcdef"})
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		})
+	})
 })
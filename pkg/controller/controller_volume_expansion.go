@@ -4,7 +4,10 @@ import (
 	"context"
 
 	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/redact"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/klog/v2"
 )
 
@@ -21,21 +24,45 @@ import (
 //
 // [Volume Expansion API]: https://kubernetes-csi.github.io/docs/volume-expansion.html
 func (cs *controller) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	klog.V(2).InfoS("Expanding volume", "id", req.GetVolumeId(), "request", req)
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Expanding volume", "id", req.GetVolumeId(), "request", redact.Secrets(req))
 
-	newCapacityBytes := sizeFromCapacityRange(req.CapacityRange)
+	if err := checkControllerExpandVolumeRequest(req); err != nil {
+		logger.V(2).Error(err, "Volume expansion request invalid")
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
+	}
+
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume not found: %s", err)
+	}
+
+	newCapacityBytes := sizeFromCapacityRange(req.GetCapacityRange())
+
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
 
-	klog.V(2).InfoS("Updating ADV volume to resize to new capacity", "new_capacity_bytes", newCapacityBytes)
+	logger.V(2).Info("Updating ADV volume to resize to new capacity", "new_capacity_bytes", newCapacityBytes)
 	v := dynamicvolumev1.Volume{
-		Identifier: req.GetVolumeId(),
+		Identifier: volumeID.volume,
 		Size:       newCapacityBytes,
 	}
-	if err := cs.engine.Update(ctx, &v); err != nil {
-		klog.V(2).ErrorS(err, "ADV volume could not be updated", "id", req.GetVolumeId())
+	if err := engine.Update(ctx, &v); err != nil {
+		logger.V(2).Error(err, "ADV volume could not be updated", "id", req.GetVolumeId())
 		return nil, engineErrorToGRPC(err)
 	}
 
-	klog.V(2).InfoS("Volume expanded successfully", "id", req.GetVolumeCapability())
+	logger.V(2).Info("Volume expanded successfully", "id", req.GetVolumeCapability())
 	return &csi.ControllerExpandVolumeResponse{
 		CapacityBytes: newCapacityBytes,
 
@@ -43,3 +70,15 @@ func (cs *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contr
 		NodeExpansionRequired: false,
 	}, nil
 }
+
+func checkControllerExpandVolumeRequest(req *csi.ControllerExpandVolumeRequest) error {
+	if req.GetVolumeId() == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if req.GetCapacityRange() == nil {
+		return ErrCapacityRangeNotProvided
+	}
+
+	return nil
+}
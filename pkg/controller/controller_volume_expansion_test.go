@@ -10,6 +10,8 @@ import (
 	"github.com/anexia/csi-driver/pkg/internal/mockapi"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestControllerExpandVolume(t *testing.T) {
@@ -81,4 +83,26 @@ func TestControllerExpandVolume(t *testing.T) {
 			t.Fatalf("Returned capacity in bytes does not match expected value, got %d, want %d", resp.CapacityBytes, oneGibibyteInBytes)
 		}
 	})
+	t.Run("requests without capacity range are rejected", func(t *testing.T) {
+		t.Parallel()
+		bundle := setup(t)
+
+		_, err := bundle.controller.ControllerExpandVolume(context.TODO(), &csi.ControllerExpandVolumeRequest{
+			VolumeId: "expand-volume",
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument error, got %#v", err)
+		}
+	})
+	t.Run("requests without volume ID are rejected", func(t *testing.T) {
+		t.Parallel()
+		bundle := setup(t)
+
+		_, err := bundle.controller.ControllerExpandVolume(context.TODO(), &csi.ControllerExpandVolumeRequest{
+			CapacityRange: &csi.CapacityRange{RequiredBytes: oneGibibyteInBytes},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument error, got %#v", err)
+		}
+	})
 }
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// ControllerModifyVolume implements the support for [VolumeAttributesClass].
+//
+// Right now, only the ADS class of a volume can be changed. The ADV volume is updated
+// in place, so the volume does not have to be unpublished for this.
+//
+// [VolumeAttributesClass]: https://kubernetes.io/docs/concepts/storage/volume-attributes-classes/
+func (cs *controller) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Modifying volume", "id", req.GetVolumeId(), "mutable_parameters", req.GetMutableParameters())
+	if err := checkControllerModifyVolumeRequest(req); err != nil {
+		logger.V(2).Error(err, "Volume modification request invalid")
+		return nil, status.Errorf(codes.InvalidArgument, "request check failed: %s", err)
+	}
+
+	done, err := cs.inflight.Start(volumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	volumeID, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "volume not found: %s", err)
+	}
+
+	v := dynamicvolumev1.Volume{
+		Identifier: volumeID.volume,
+		ADSClass:   req.GetMutableParameters()["csi.anx.io/ads-class"],
+	}
+
+	engine, err := cs.engineForVolume(volumeID, req.GetSecrets())
+	if err != nil {
+		logger.V(2).Error(err, "No Engine API client available")
+		return nil, err
+	}
+
+	logger.V(2).Info("Updating ADV volume", "ads_class", v.ADSClass)
+	if err := engine.Update(ctx, &v); err != nil {
+		logger.V(2).Error(err, "ADV volume could not be updated", "id", req.GetVolumeId())
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(4).Info("ADV volume updated, awaiting completion", "id", req.GetVolumeId())
+	if err := awaitCompletion(ctx, engine, &v); err != nil {
+		logger.V(2).Error(err, "ADV volume did not transition into completion", "id", req.GetVolumeId())
+		if errors.Is(err, gs.ErrStateError) {
+			return nil, status.Errorf(codes.Internal, "ADV volume went into error state while being modified")
+		}
+		return nil, engineErrorToGRPC(err)
+	}
+
+	logger.V(2).Info("Volume modified successfully", "id", req.GetVolumeId())
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+func checkControllerModifyVolumeRequest(req *csi.ControllerModifyVolumeRequest) error {
+	if req.VolumeId == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if len(req.MutableParameters) == 0 {
+		return ErrMutableParametersNotProvided
+	}
+
+	return checkMutableParameters(req.MutableParameters)
+}
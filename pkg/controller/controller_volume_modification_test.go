@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller Service Volume Modification", func() {
+	var (
+		cs     *controller
+		engine *mockapi.MockAPI
+	)
+
+	BeforeEach(func() {
+		c := gomock.NewController(GinkgoT())
+		engine = mockapi.NewMockAPI(c)
+		cs = &controller{engine: engine}
+	})
+
+	Context("ControllerModifyVolume", func() {
+		var validRequest *csi.ControllerModifyVolumeRequest
+
+		BeforeEach(func() {
+			validRequest = &csi.ControllerModifyVolumeRequest{
+				VolumeId:          "modify-volume",
+				MutableParameters: map[string]string{"csi.anx.io/ads-class": "ENT6"},
+			}
+		})
+
+		DescribeTable("rejects invalid requests",
+			func(req *csi.ControllerModifyVolumeRequest) {
+				_, err := cs.ControllerModifyVolume(context.TODO(), req)
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			},
+			Entry("without volume ID", &csi.ControllerModifyVolumeRequest{MutableParameters: map[string]string{"csi.anx.io/ads-class": "ENT2"}}),
+			Entry("without mutable parameters", &csi.ControllerModifyVolumeRequest{VolumeId: "modify-volume"}),
+			Entry("with an empty ADS class", &csi.ControllerModifyVolumeRequest{VolumeId: "modify-volume", MutableParameters: map[string]string{"csi.anx.io/ads-class": ""}}),
+			Entry("with an immutable parameter", &csi.ControllerModifyVolumeRequest{VolumeId: "modify-volume", MutableParameters: map[string]string{"csi.anx.io/storage-server-identifier": "foo"}}),
+		)
+
+		It("returns engine errors", func() {
+			engine.EXPECT().
+				Update(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "modify-volume", ADSClass: "ENT6"}).
+				Return(errors.New("mock error"))
+
+			_, err := cs.ControllerModifyVolume(context.TODO(), validRequest)
+			Expect(err).To(MatchError(ContainSubstring("mock error")))
+		})
+
+		It("updates the volume and awaits completion", func() {
+			gomock.InOrder(
+				engine.EXPECT().
+					Update(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "modify-volume", ADSClass: "ENT6"}).
+					Return(nil),
+				// AwaitCompletion
+				engine.EXPECT().
+					Get(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+						v.State.Type = gs.StateTypeOK
+						return nil
+					}),
+			)
+
+			_, err := cs.ControllerModifyVolume(context.TODO(), validRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// secretKeyToken is the key of the Anexia Engine token in the secrets of a request.
+const secretKeyToken = "token"
+
+func newEngineFromToken(token string) (api.API, error) {
+	engine, err := api.NewAPI(api.WithClientOptions(client.TokenFromString(token)))
+	if err != nil {
+		return nil, err
+	}
+
+	return instrumentAPI(engine), nil
+}
+
+// loadCredentials creates the API clients for the tokens in the files of the given directory,
+// keyed by their reference. Hidden files and directories are skipped, like the ones created
+// by Kubernetes when mounting a Secret.
+func loadCredentials(dir string, newEngine func(token string) (api.API, error)) (map[string]api.API, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	engines := make(map[string]api.API, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			klog.V(1).InfoS("Ignoring empty credentials file", "path", path)
+			continue
+		}
+
+		engine, err := newEngine(token)
+		if err != nil {
+			return nil, fmt.Errorf("error creating API client with token from %q: %w", path, err)
+		}
+
+		key := credentialsRef(token)
+		klog.V(2).InfoS("Loaded Engine token from credentials file", "path", path, "token_hash", key[:8])
+		engines[key] = engine
+	}
+
+	return engines, nil
+}
+
+// credentialsRef returns the reference to the given token, which is encoded into the IDs of
+// volumes created with it. We don't want to keep the plain token around longer than required,
+// so this is a truncated hash of it.
+func credentialsRef(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:8])
+}
+
+// credentialsForSecrets returns the reference to the token in the given secrets, which is
+// empty if they contain none.
+func credentialsForSecrets(secrets map[string]string) string {
+	token := secrets[secretKeyToken]
+	if token == "" {
+		return ""
+	}
+
+	return credentialsRef(token)
+}
+
+// engineForSecrets returns the API client to use for a request with the given secrets.
+//
+// If the secrets contain a token, an API client for it is created and cached for
+// further requests. Otherwise the API client with the token from the environment
+// is used, if there is one.
+func (cs *controller) engineForSecrets(secrets map[string]string) (api.API, error) {
+	token := secrets[secretKeyToken]
+	if token == "" {
+		if cs.engine == nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "no Engine token given, neither in the secrets of the request nor in the environment")
+		}
+
+		return cs.engine, nil
+	}
+
+	key := credentialsRef(token)
+
+	cs.enginesMutex.Lock()
+	defer cs.enginesMutex.Unlock()
+
+	if engine, ok := cs.engines[key]; ok {
+		return engine, nil
+	}
+
+	newEngine := cs.newEngine
+	if newEngine == nil {
+		newEngine = newEngineFromToken
+	}
+
+	klog.V(4).InfoS("Creating API client for token from secrets", "token_hash", key[:8])
+	engine, err := newEngine(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error creating API client with token from secrets: %s", err)
+	}
+
+	if cs.engines == nil {
+		cs.engines = make(map[string]api.API)
+	}
+	cs.engines[key] = engine
+
+	return engine, nil
+}
+
+// engineForVolume returns the API client to use for a request on the given volume.
+//
+// A token in the secrets of the request takes precedence. Otherwise the API client for the
+// token the volume was created with is used, which is known if it's in the credentials
+// directory or a request with it in its secrets was received since the driver started.
+// Volumes created with the token from the environment use the API client for it.
+func (cs *controller) engineForVolume(id volumeID, secrets map[string]string) (api.API, error) {
+	if secrets[secretKeyToken] != "" || id.credentials == "" {
+		return cs.engineForSecrets(secrets)
+	}
+
+	cs.enginesMutex.Lock()
+	defer cs.enginesMutex.Unlock()
+
+	engine, ok := cs.engines[id.credentials]
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "the Engine token of volume %q is not known yet, as it's not in the credentials directory and no request with it in its secrets was received since the driver started", id)
+	}
+
+	return engine, nil
+}
+
+// cachedEngines returns the API clients for all tokens received in the secrets of requests,
+// keyed by their reference.
+func (cs *controller) cachedEngines() map[string]api.API {
+	cs.enginesMutex.Lock()
+	defer cs.enginesMutex.Unlock()
+
+	return maps.Clone(cs.engines)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	"github.com/golang/mock/gomock"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	Context("engineForSecrets", func() {
+		It("falls back to the engine from the environment", func() {
+			defaultEngine := mockapi.NewMockAPI(gomock.NewController(GinkgoT()))
+			cs := &controller{engine: defaultEngine}
+
+			engine, err := cs.engineForSecrets(map[string]string{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(engine).To(BeIdenticalTo(defaultEngine))
+		})
+
+		It("fails without any token", func() {
+			cs := &controller{}
+
+			_, err := cs.engineForSecrets(nil)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		})
+
+		It("caches an engine per token", func() {
+			c := gomock.NewController(GinkgoT())
+
+			var createdFor []string
+			cs := &controller{
+				engine: mockapi.NewMockAPI(c),
+				newEngine: func(token string) (api.API, error) {
+					createdFor = append(createdFor, token)
+					return mockapi.NewMockAPI(c), nil
+				},
+			}
+
+			first, _ := cs.engineForSecrets(map[string]string{"token": "first"})
+			second, _ := cs.engineForSecrets(map[string]string{"token": "second"})
+			again, _ := cs.engineForSecrets(map[string]string{"token": "first"})
+
+			Expect(first).ToNot(BeIdenticalTo(second))
+			Expect(again).To(BeIdenticalTo(first))
+			Expect(createdFor).To(Equal([]string{"first", "second"}))
+		})
+
+		It("returns errors creating the engine", func() {
+			cs := &controller{
+				newEngine: func(string) (api.API, error) { return nil, errors.New("mock error") },
+			}
+
+			_, err := cs.engineForSecrets(map[string]string{"token": "foo"})
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+
+	Context("loadCredentials", func() {
+		It("creates an engine per token file, skipping hidden and empty files", func() {
+			dir := GinkgoT().TempDir()
+			// layout of a mounted Secret, with the files linked to the current version
+			Expect(os.Mkdir(filepath.Join(dir, "..data"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "..data", "customer-a"), []byte("first\n"), 0o600)).To(Succeed())
+			Expect(os.Symlink(filepath.Join("..data", "customer-a"), filepath.Join(dir, "customer-a"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "customer-b"), []byte("second"), 0o600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "empty"), nil, 0o600)).To(Succeed())
+
+			var createdFor []string
+			engines, err := loadCredentials(dir, func(token string) (api.API, error) {
+				createdFor = append(createdFor, token)
+				return mockapi.NewMockAPI(gomock.NewController(GinkgoT())), nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdFor).To(Equal([]string{"first", "second"}))
+			Expect(engines).To(HaveKey(credentialsRef("first")))
+			Expect(engines).To(HaveKey(credentialsRef("second")))
+		})
+
+		It("returns errors creating the engine", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "customer-a"), []byte("first"), 0o600)).To(Succeed())
+
+			_, err := loadCredentials(dir, func(string) (api.API, error) { return nil, errors.New("mock error") })
+			Expect(err).To(MatchError(ContainSubstring("mock error")))
+		})
+
+		It("fails if the directory does not exist", func() {
+			_, err := loadCredentials(filepath.Join(GinkgoT().TempDir(), "missing"), newEngineFromToken)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("engineForVolume", func() {
+		var (
+			cs            *controller
+			defaultEngine *mockapi.MockAPI
+			secretsEngine *mockapi.MockAPI
+		)
+
+		BeforeEach(func() {
+			c := gomock.NewController(GinkgoT())
+			defaultEngine = mockapi.NewMockAPI(c)
+			secretsEngine = mockapi.NewMockAPI(c)
+			cs = &controller{
+				engine:    defaultEngine,
+				newEngine: func(string) (api.API, error) { return secretsEngine, nil },
+			}
+		})
+
+		It("uses the engine of the token referenced in the volume ID", func() {
+			_, err := cs.engineForSecrets(map[string]string{"token": "foo"})
+			Expect(err).ToNot(HaveOccurred())
+
+			engine, err := cs.engineForVolume(volumeID{volume: "volume", storageServer: "storage-server", credentials: credentialsRef("foo")}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(engine).To(BeIdenticalTo(secretsEngine))
+		})
+
+		It("uses the engine of a token loaded from the credentials directory", func() {
+			loadedEngine := mockapi.NewMockAPI(gomock.NewController(GinkgoT()))
+			cs.engines = map[string]api.API{credentialsRef("foo"): loadedEngine}
+
+			engine, err := cs.engineForVolume(volumeID{volume: "volume", storageServer: "storage-server", credentials: credentialsRef("foo")}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(engine).To(BeIdenticalTo(loadedEngine))
+		})
+
+		It("fails for unknown tokens", func() {
+			_, err := cs.engineForVolume(volumeID{volume: "volume", storageServer: "storage-server", credentials: credentialsRef("foo")}, nil)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		})
+
+		It("prefers the token from the secrets", func() {
+			engine, err := cs.engineForVolume(volumeID{volume: "volume", storageServer: "storage-server", credentials: credentialsRef("bar")}, map[string]string{"token": "foo"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(engine).To(BeIdenticalTo(secretsEngine))
+		})
+
+		It("uses the engine from the environment for volumes without token reference", func() {
+			engine, err := cs.engineForVolume(volumeID{volume: "volume", storageServer: "storage-server"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(engine).To(BeIdenticalTo(defaultEngine))
+		})
+	})
+})
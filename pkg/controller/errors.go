@@ -9,6 +9,23 @@ var (
 	ErrNameNotProvided = errors.New("name was not provided")
 	// ErrCapacityRangeNotProvided is returned if no capacity range was provided
 	ErrCapacityRangeNotProvided = errors.New("capacity range was not provided")
+	// ErrNodeIDNotProvided is returned if no node id was provided
+	ErrNodeIDNotProvided = errors.New("node id was not provided")
+	// ErrVolumeCapabilityNotProvided is returned if no volume capability was provided
+	ErrVolumeCapabilityNotProvided = errors.New("volume capability was not provided")
+	// ErrSnapshotIDNotProvided is returned if no snapshot id was provided
+	ErrSnapshotIDNotProvided = errors.New("snapshot id was not provided")
+	// ErrSourceVolumeIDNotProvided is returned if no source volume id was provided
+	ErrSourceVolumeIDNotProvided = errors.New("source volume id was not provided")
+
+	// ErrStorageServerIdentifierNotProvided is returned if no storage server interface identifier was provided in the parameters
+	ErrStorageServerIdentifierNotProvided = errors.New("storage server interface identifier was not provided")
+	// ErrADSClassNotProvided is returned if no ADS class was provided in the parameters
+	ErrADSClassNotProvided = errors.New("ADS class was not provided")
+	// ErrMutableParametersNotProvided is returned if no mutable parameters were provided
+	ErrMutableParametersNotProvided = errors.New("mutable parameters were not provided")
+	// ErrParameterNotMutable is returned if a parameter was requested to be changed, which cannot be modified
+	ErrParameterNotMutable = errors.New("parameter cannot be modified")
 
 	// ErrVolumeCapabilitiesNotProvided is returned if volumes capabilities haven't been set
 	ErrVolumeCapabilitiesNotProvided = errors.New("volume capabilities not set")
@@ -20,6 +37,12 @@ var (
 	// ErrVolumeWithSameNameButDifferentSizeAlreadyExists is returned if a volume with the same name but different size already exists
 	ErrVolumeWithSameNameButDifferentSizeAlreadyExists = errors.New("volume with the same name, but different size already exists")
 
+	// ErrInvalidVolumeID is returned if a volume id cannot be parsed
+	ErrInvalidVolumeID = errors.New("invalid volume id")
+
+	// ErrInvalidStartingToken is returned if the starting token of a list request cannot be parsed
+	ErrInvalidStartingToken = errors.New("starting token is not a valid offset")
+
 	// ErrQueryingIPAddressesFailed is returned whenever we actually receive a
 	// storage server interface from the Engine, but that has no IP addresses. This is
 	// almost always due to missing IPAM permissions.
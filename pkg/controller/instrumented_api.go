@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/anexia/csi-driver/pkg/internal/metrics"
+	"github.com/anexia/csi-driver/pkg/internal/tracing"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// instrumentedAPI records all requests to the Engine in the metrics, and traces them.
+type instrumentedAPI struct {
+	api.API
+}
+
+func instrumentAPI(engine api.API) api.API {
+	return instrumentedAPI{engine}
+}
+
+// resourceName returns the name of the type of the given object, e.g. "Volume".
+func resourceName(object types.Object) string {
+	return reflect.Indirect(reflect.ValueOf(object)).Type().Name()
+}
+
+// observe runs the given request in a span and records it with the operation and the type of
+// the given object.
+func observe(ctx context.Context, operation string, object types.Object, request func(context.Context) error) error {
+	resource := resourceName(object)
+
+	start := time.Now()
+	err := tracing.Run(ctx, "engine."+operation, request, attribute.String("engine.resource", resource))
+	metrics.EngineRequestDuration.WithLabelValues(operation, resource, metrics.EngineResult(err)).Observe(metrics.Since(start))
+
+	return err
+}
+
+// awaitCompletion waits for the given object to be processed by the Engine like gs.AwaitCompletion,
+// in a span.
+func awaitCompletion(ctx context.Context, engine api.API, object types.IdentifiedObject) error {
+	return tracing.Run(ctx, "engine.await_completion", func(ctx context.Context) error {
+		return gs.AwaitCompletion(ctx, engine, object)
+	}, attribute.String("engine.resource", resourceName(object)))
+}
+
+func (a instrumentedAPI) Get(ctx context.Context, o types.IdentifiedObject, opts ...types.GetOption) error {
+	return observe(ctx, "get", o, func(ctx context.Context) error { return a.API.Get(ctx, o, opts...) })
+}
+
+func (a instrumentedAPI) Create(ctx context.Context, o types.Object, opts ...types.CreateOption) error {
+	return observe(ctx, "create", o, func(ctx context.Context) error { return a.API.Create(ctx, o, opts...) })
+}
+
+func (a instrumentedAPI) Update(ctx context.Context, o types.IdentifiedObject, opts ...types.UpdateOption) error {
+	return observe(ctx, "update", o, func(ctx context.Context) error { return a.API.Update(ctx, o, opts...) })
+}
+
+func (a instrumentedAPI) Destroy(ctx context.Context, o types.IdentifiedObject, opts ...types.DestroyOption) error {
+	return observe(ctx, "destroy", o, func(ctx context.Context) error { return a.API.Destroy(ctx, o, opts...) })
+}
+
+func (a instrumentedAPI) List(ctx context.Context, o types.FilterObject, opts ...types.ListOption) error {
+	return observe(ctx, "list", o, func(ctx context.Context) error { return a.API.List(ctx, o, opts...) })
+}
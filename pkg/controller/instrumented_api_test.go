@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/metrics"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Instrumented API", func() {
+	var (
+		engine       *mockapi.MockAPI
+		instrumented api.API
+	)
+
+	BeforeEach(func() {
+		engine = mockapi.NewMockAPI(gomock.NewController(GinkgoT()))
+		instrumented = instrumentAPI(engine)
+	})
+
+	engineRequestCount := func(operation, resource, result string) uint64 {
+		var m dto.Metric
+		Expect(metrics.EngineRequestDuration.WithLabelValues(operation, resource, result).(prometheus.Metric).Write(&m)).To(Succeed())
+
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	It("records the duration of requests with their result", func() {
+		successes := engineRequestCount("list", "Quota", "success")
+		notFounds := engineRequestCount("destroy", "Volume", "404")
+
+		engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.Quota{}).Return(nil)
+		engine.EXPECT().Destroy(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "foo"}).Return(api.NewHTTPError(404, "DELETE", nil, nil))
+
+		Expect(instrumented.List(context.TODO(), &dynamicvolumev1.Quota{})).To(Succeed())
+		Expect(instrumented.Destroy(context.TODO(), &dynamicvolumev1.Volume{Identifier: "foo"})).ToNot(Succeed())
+
+		Expect(engineRequestCount("list", "Quota", "success")).To(Equal(successes + 1))
+		Expect(engineRequestCount("destroy", "Volume", "404")).To(Equal(notFounds + 1))
+	})
+
+	It("traces requests as children of the span in the context", func() {
+		exporter := tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+		engine.EXPECT().Destroy(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "foo"}).Return(errors.New("mock error"))
+		engine.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+			v.State.Type = gs.StateTypeOK
+			return nil
+		})
+
+		ctx, parent := otel.Tracer("test").Start(context.TODO(), "parent")
+		_ = instrumented.Destroy(ctx, &dynamicvolumev1.Volume{Identifier: "foo"})
+		Expect(awaitCompletion(ctx, instrumented, &dynamicvolumev1.Volume{Identifier: "foo"})).To(Succeed())
+		parent.End()
+
+		spans := exporter.GetSpans()
+		names := make([]string, 0, len(spans))
+		for _, span := range spans {
+			names = append(names, span.Name)
+		}
+
+		// spans are exported when they end, children before their parents
+		Expect(names).To(Equal([]string{"engine.destroy", "engine.get", "engine.await_completion", "parent"}))
+
+		// the failed request is a child of the parent with an error
+		Expect(spans[0].Parent.SpanID()).To(Equal(parent.SpanContext().SpanID()))
+		Expect(spans[0].Status.Code).To(Equal(codes.Error))
+
+		// the requests awaiting completion are children of it
+		Expect(spans[1].Parent.SpanID()).To(Equal(spans[2].SpanContext.SpanID()))
+	})
+})
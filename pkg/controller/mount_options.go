@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	csitypes "github.com/anexia/csi-driver/pkg/types"
+)
+
+// supportedNFSVersions are the values accepted for the `csi.anx.io/nfs-version` parameter.
+var supportedNFSVersions = []string{"3", "4", "4.0", "4.1", "4.2"}
+
+// mountOptionsFromParameters parses the `csi.anx.io/nfs-version` and `csi.anx.io/mount-options`
+// StorageClass parameters and returns the volume context entries passing them to the node.
+func mountOptionsFromParameters(parameters map[string]string) (map[string]string, error) {
+	volumeContext := map[string]string{}
+
+	if version, ok := parameters["csi.anx.io/nfs-version"]; ok {
+		if !slices.Contains(supportedNFSVersions, version) {
+			return nil, fmt.Errorf("invalid value for csi.anx.io/nfs-version: %q, must be one of %s", version, strings.Join(supportedNFSVersions, ", "))
+		}
+
+		volumeContext[csitypes.VolumeContextNFSVersion] = version
+	}
+
+	if value, ok := parameters["csi.anx.io/mount-options"]; ok {
+		options := strings.Split(value, ",")
+		for i, option := range options {
+			option = strings.TrimSpace(option)
+			name, _, _ := strings.Cut(option, "=")
+
+			switch {
+			case option == "":
+				return nil, errors.New("invalid value for csi.anx.io/mount-options: empty mount option")
+			case strings.ContainsAny(option, " \t\n"):
+				return nil, fmt.Errorf("invalid value for csi.anx.io/mount-options: mount option %q contains whitespace", option)
+			case name == "vers" || name == "nfsvers":
+				return nil, errors.New("invalid value for csi.anx.io/mount-options: use csi.anx.io/nfs-version to set the NFS version")
+			}
+
+			options[i] = option
+		}
+
+		volumeContext[csitypes.VolumeContextMountOptions] = strings.Join(options, ",")
+	}
+
+	return volumeContext, nil
+}
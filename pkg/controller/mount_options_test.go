@@ -0,0 +1,34 @@
+package controller
+
+import (
+	csitypes "github.com/anexia/csi-driver/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("mountOptionsFromParameters", func() {
+	DescribeTable("valid parameters",
+		func(parameters map[string]string, expected map[string]string) {
+			volumeContext, err := mountOptionsFromParameters(parameters)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(volumeContext).To(Equal(expected))
+		},
+		Entry("not set", map[string]string{}, map[string]string{}),
+		Entry("NFS version", map[string]string{"csi.anx.io/nfs-version": "4.1"}, map[string]string{csitypes.VolumeContextNFSVersion: "4.1"}),
+		Entry("mount options with whitespace around them",
+			map[string]string{"csi.anx.io/mount-options": "hard, timeo=600 ,nolock"},
+			map[string]string{csitypes.VolumeContextMountOptions: "hard,timeo=600,nolock"},
+		),
+	)
+
+	DescribeTable("invalid parameters",
+		func(parameters map[string]string) {
+			_, err := mountOptionsFromParameters(parameters)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("unsupported NFS version", map[string]string{"csi.anx.io/nfs-version": "2"}),
+		Entry("empty mount option", map[string]string{"csi.anx.io/mount-options": "hard,,nolock"}),
+		Entry("mount option with whitespace", map[string]string{"csi.anx.io/mount-options": "timeo= 600"}),
+		Entry("NFS version in mount options", map[string]string{"csi.anx.io/mount-options": "nfsvers=4.1"}),
+	)
+})
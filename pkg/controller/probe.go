@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.anx.io/go-anxcloud/pkg/api"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+)
+
+const (
+	// engineCheckTimeout limits the time checking the Anexia Engine may take.
+	engineCheckTimeout = 10 * time.Second
+
+	// engineCheckCacheDuration is the time the result of checking the Anexia Engine is reused,
+	// as the liveness probe calls Probe every few seconds.
+	engineCheckCacheDuration = time.Minute
+)
+
+// errNoStorageServerInterface is returned by checkEngine if no storage server interface is usable.
+var errNoStorageServerInterface = errors.New("no storage server interface with an IP address in a non-error state is accessible")
+
+// engineCheck caches the result of checking the Anexia Engine. The zero value is ready to use.
+type engineCheck struct {
+	mu sync.Mutex
+
+	// pending is closed once the running check is done, nil if no check is running.
+	pending chan struct{}
+	checked time.Time
+	err     error
+}
+
+// Probe checks that the Engine token from the environment is valid and a storage server interface
+// is usable with it. Without token in the environment, the tokens are only known per request,
+// so there is nothing to check.
+//
+// The check is cached and runs detached from the request, so a slow Engine doesn't fail the probe
+// repeatedly: a probe giving up on waiting leaves the result to the next one.
+func (cs *controller) Probe(ctx context.Context) error {
+	if cs.engine == nil {
+		return nil
+	}
+
+	c := &cs.engineCheck
+	c.mu.Lock()
+	if time.Since(c.checked) < engineCheckCacheDuration {
+		defer c.mu.Unlock()
+		return c.err
+	}
+
+	pending := c.pending
+	if pending == nil {
+		pending = make(chan struct{})
+		c.pending = pending
+
+		go c.run(context.WithoutCancel(ctx), cs.engine)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-pending:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return c.err
+	case <-ctx.Done():
+		return fmt.Errorf("checking the Anexia Engine did not finish in time: %w", ctx.Err())
+	}
+}
+
+func (c *engineCheck) run(ctx context.Context, engine types.API) {
+	ctx, cancel := context.WithTimeout(ctx, engineCheckTimeout)
+	defer cancel()
+
+	err := checkEngine(ctx, engine)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checked, c.err = time.Now(), err
+	close(c.pending)
+	c.pending = nil
+}
+
+// checkEngine verifies the token of the given client by listing the storage server interfaces,
+// requiring at least one of them to be usable for volumes.
+func checkEngine(ctx context.Context, engine types.API) error {
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.StorageServerInterface{}, api.ObjectChannel(&channel), api.FullObjects(true)); err != nil {
+		return fmt.Errorf("failed listing storage server interfaces, the Anexia Engine token may be invalid: %w", err)
+	}
+
+	usable := false
+	for retriever := range channel {
+		var storageServer dynamicvolumev1.StorageServerInterface
+		if err := retriever(&storageServer); err != nil {
+			return fmt.Errorf("failed retrieving storage server interface: %w", err)
+		}
+
+		if storageServer.State.Type != gs.StateTypeError && storageServer.IPAddress.Name != "" {
+			usable = true
+		}
+	}
+
+	if !usable {
+		return errNoStorageServerInterface
+	}
+
+	return nil
+}
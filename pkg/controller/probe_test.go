@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"go.anx.io/go-anxcloud/pkg/api/types"
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller Service Probe", func() {
+	var (
+		cs     *controller
+		engine *mockapi.MockAPI
+	)
+
+	usable := dynamicvolumev1.StorageServerInterface{Identifier: "storage-server-1", IPAddress: dynamicvolumev1.IPAddress{Name: "10.0.0.1"}}
+
+	BeforeEach(func() {
+		c := gomock.NewController(GinkgoT())
+		engine = mockapi.NewMockAPI(c)
+		cs = &controller{engine: engine}
+	})
+
+	It("is ready without token in the environment", func() {
+		cs = &controller{}
+		Expect(cs.Probe(context.TODO())).To(Succeed())
+	})
+
+	It("is ready with a usable storage server interface, caching the result", func() {
+		engine.EXPECT().List(gomock.Any(), &dynamicvolumev1.StorageServerInterface{}, gomock.Any()).
+			DoAndReturn(listReturning(usable)).
+			Times(1)
+
+		Expect(cs.Probe(context.TODO())).To(Succeed())
+		Expect(cs.Probe(context.TODO())).To(Succeed())
+	})
+
+	It("is not ready if the token is rejected", func() {
+		engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+
+		Expect(cs.Probe(context.TODO())).To(MatchError(ContainSubstring("token may be invalid")))
+	})
+
+	It("is not ready without usable storage server interface", func() {
+		failed := usable
+		failed.State.Type = gs.StateTypeError
+		engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(listReturning(failed, dynamicvolumev1.StorageServerInterface{Identifier: "storage-server-2"}))
+
+		Expect(cs.Probe(context.TODO())).To(MatchError(errNoStorageServerInterface))
+	})
+
+	It("keeps checking a slow Engine for the next probe", func() {
+		unblock := make(chan struct{})
+		engine.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, o types.FilterObject, opts ...types.ListOption) error {
+				<-unblock
+				return listReturning(usable)(ctx, o, opts...)
+			}).
+			Times(1)
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		Expect(cs.Probe(ctx)).To(MatchError(context.DeadlineExceeded))
+
+		close(unblock)
+		Eventually(cs.Probe).WithArguments(context.TODO()).Should(Succeed())
+	})
+})
@@ -4,9 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	csitypes "github.com/anexia/csi-driver/pkg/types"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/hashicorp/go-multierror"
 	"go.anx.io/go-anxcloud/pkg/api"
@@ -88,6 +94,52 @@ func checkValidateVolumeCapabilitiesRequest(req *csi.ValidateVolumeCapabilitiesR
 	return nil
 }
 
+// paginate calculates the window of a list with total entries for a list request.
+// The starting token is the offset of the first entry to return, the returned
+// next token is empty if there are no further entries.
+func paginate(total int, startingToken string, maxEntries int32) (start, end int, nextToken string, err error) {
+	if startingToken != "" {
+		start, err = strconv.Atoi(startingToken)
+		if err != nil || start < 0 || start > total {
+			return 0, 0, "", ErrInvalidStartingToken
+		}
+	}
+
+	end = total
+	if maxEntries > 0 && start+int(maxEntries) < total {
+		end = start + int(maxEntries)
+		nextToken = strconv.Itoa(end)
+	}
+
+	return start, end, nextToken, nil
+}
+
+// checkADSClass checks the ADS class given for a volume.
+func checkADSClass(adsClass string) error {
+	if adsClass == "" {
+		return ErrADSClassNotProvided
+	}
+
+	return nil
+}
+
+// checkMutableParameters checks the parameters given in a VolumeAttributesClass, which
+// are used both when creating and modifying a volume.
+func checkMutableParameters(parameters map[string]string) error {
+	for key, value := range parameters {
+		switch key {
+		case "csi.anx.io/ads-class":
+			if err := checkADSClass(value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %s", ErrParameterNotMutable, key)
+		}
+	}
+
+	return nil
+}
+
 func sizeFromCapacityRange(capacityRange *csi.CapacityRange) int64 {
 	size := defaultVolumeSize
 
@@ -110,19 +162,48 @@ func sizeFromCapacityRange(capacityRange *csi.CapacityRange) int64 {
 	return size
 }
 
-func createAnexiaDynamicVolumeFromRequest(ctx context.Context, engine types.API, req *csi.CreateVolumeRequest) (*dynamicvolumev1.Volume, error) {
+func createAnexiaDynamicVolumeFromRequest(ctx context.Context, engine types.API, req *csi.CreateVolumeRequest, storageServerID string, prefixIdentifiers []string) (*dynamicvolumev1.Volume, error) {
+	logger := klog.FromContext(ctx)
+
+	// Parameters of a VolumeAttributesClass take precedence over the ones of the StorageClass.
+	adsClass := req.Parameters["csi.anx.io/ads-class"]
+	if mutableADSClass, ok := req.GetMutableParameters()["csi.anx.io/ads-class"]; ok {
+		adsClass = mutableADSClass
+	}
+
+	if err := checkMutableParameters(req.GetMutableParameters()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mutable parameters: %s", err)
+	}
+
+	if err := checkADSClass(adsClass); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %s", err)
+	}
+
 	volume := dynamicvolumev1.Volume{
 		Name:                    req.GetName(),
 		Size:                    sizeFromCapacityRange(req.GetCapacityRange()),
-		StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: req.Parameters["csi.anx.io/storage-server-identifier"]}},
-		ADSClass:                req.Parameters["csi.anx.io/ads-class"],
+		StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: storageServerID}},
+		ADSClass:                adsClass,
 	}
-	klog.V(4).InfoS("Creating new ADV volume", "volume", volume)
+
+	if len(prefixIdentifiers) > 0 {
+		prefixes := make([]dynamicvolumev1.Prefix, 0, len(prefixIdentifiers))
+		for _, identifier := range prefixIdentifiers {
+			prefixes = append(prefixes, dynamicvolumev1.Prefix{Identifier: identifier})
+		}
+		volume.Prefixes = &prefixes
+	}
+
+	if err := applyVolumeContentSource(ctx, engine, req.GetVolumeContentSource(), &volume); err != nil {
+		return nil, err
+	}
+
+	logger.V(4).Info("Creating new ADV volume", "volume", volume)
 
 	if err := engine.Create(ctx, &volume); err != nil {
 		httpError := api.HTTPError{}
 		if errors.As(err, &httpError) && httpError.StatusCode() == http.StatusUnprocessableEntity {
-			klog.V(4).InfoS("Volume already exists at engine", "name", req.GetName())
+			logger.V(4).Info("Volume already exists at engine", "name", req.GetName())
 			// if we land here, probably there exists another volume with the same name
 			return handleIdempotency(ctx, engine, req)
 		}
@@ -130,14 +211,14 @@ func createAnexiaDynamicVolumeFromRequest(ctx context.Context, engine types.API,
 		return nil, fmt.Errorf("create volume: %w", err)
 	}
 
-	klog.V(4).InfoS("ADV volume created, awaiting completion", "engine_identifier", volume.Identifier)
-	if err := gs.AwaitCompletion(ctx, engine, &volume); err != nil {
+	logger.V(4).Info("ADV volume created, awaiting completion", "engine_identifier", volume.Identifier)
+	if err := awaitCompletion(ctx, engine, &volume); err != nil {
 		switch {
 		case errors.Is(err, gs.ErrStateError):
-			klog.V(2).InfoS("ADV volume went into error state, deleting it", "engine_identifier", volume.Identifier)
+			logger.V(2).Info("ADV volume went into error state, deleting it", "engine_identifier", volume.Identifier)
 			err := engine.Destroy(ctx, &volume)
 			if err != nil {
-				klog.V(2).ErrorS(err, "Faulty ADV volume could not be deleted", "engine_identifier", volume.Identifier)
+				logger.V(2).Error(err, "Faulty ADV volume could not be deleted", "engine_identifier", volume.Identifier)
 				return nil, fmt.Errorf("ADV volume deletion of faulty volume failed: %w", err)
 			}
 
@@ -151,8 +232,70 @@ func createAnexiaDynamicVolumeFromRequest(ctx context.Context, engine types.API,
 	return &volume, nil
 }
 
+// applyVolumeContentSource configures the given volume to be created with the contents
+// of the requested snapshot or volume, checking that the source exists and fits into
+// the volume.
+func applyVolumeContentSource(ctx context.Context, engine types.API, source *csi.VolumeContentSource, volume *dynamicvolumev1.Volume) error {
+	logger := klog.FromContext(ctx)
+	switch {
+	case source.GetSnapshot() != nil:
+		snapshot := dynamicvolumev1.Snapshot{Identifier: source.GetSnapshot().GetSnapshotId()}
+		logger.V(4).Info("Volume is created from snapshot, querying it", "snapshot_id", snapshot.Identifier)
+		if err := engine.Get(ctx, &snapshot); err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				return status.Errorf(codes.NotFound, "source snapshot not found: %s", err)
+			}
+			return fmt.Errorf("failed retrieving source snapshot: %w", err)
+		}
+
+		if snapshot.Size > volume.Size {
+			return status.Errorf(codes.OutOfRange, "requested size %d is smaller than the source snapshot size %d", volume.Size, snapshot.Size)
+		}
+
+		volume.Snapshot = &dynamicvolumev1.Snapshot{Identifier: snapshot.Identifier}
+	case source.GetVolume() != nil:
+		sourceVolumeID, err := parseVolumeID(source.GetVolume().GetVolumeId())
+		if err != nil {
+			return status.Errorf(codes.NotFound, "source volume not found: %s", err)
+		}
+
+		sourceVolume := dynamicvolumev1.Volume{Identifier: sourceVolumeID.volume}
+		logger.V(4).Info("Volume is cloned from another volume, querying it", "source_volume_id", sourceVolume.Identifier)
+		if err := engine.Get(ctx, &sourceVolume); err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				return status.Errorf(codes.NotFound, "source volume not found: %s", err)
+			}
+			return fmt.Errorf("failed retrieving source volume: %w", err)
+		}
+
+		if sourceVolume.Size > volume.Size {
+			return status.Errorf(codes.OutOfRange, "requested size %d is smaller than the source volume size %d", volume.Size, sourceVolume.Size)
+		}
+
+		volume.SourceVolume = &dynamicvolumev1.Volume{Identifier: sourceVolume.Identifier}
+	}
+
+	return nil
+}
+
+// volumeMatchesContentSource checks if an existing volume was created from the
+// given content source. As the Engine might not return the source of a volume,
+// a volume without any source information is considered to be matching.
+func volumeMatchesContentSource(volume *dynamicvolumev1.Volume, source *csi.VolumeContentSource) bool {
+	switch {
+	case source.GetSnapshot() != nil:
+		return volume.Snapshot == nil || volume.Snapshot.Identifier == source.GetSnapshot().GetSnapshotId()
+	case source.GetVolume() != nil:
+		sourceVolumeID, _ := parseVolumeID(source.GetVolume().GetVolumeId())
+		return volume.SourceVolume == nil || volume.SourceVolume.Identifier == sourceVolumeID.volume
+	}
+
+	return volume.Snapshot == nil && volume.SourceVolume == nil
+}
+
 func handleIdempotency(ctx context.Context, engine types.API, req *csi.CreateVolumeRequest) (*dynamicvolumev1.Volume, error) {
-	klog.V(2).InfoS("Searching for existing volume with same name", "name", req.GetName())
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Searching for existing volume with same name", "name", req.GetName())
 	original, err := findVolumeByName(ctx, engine, req.GetName())
 	if err != nil {
 		// chosen codes.Internal over NotFound
@@ -160,15 +303,20 @@ func handleIdempotency(ctx context.Context, engine types.API, req *csi.CreateVol
 		return nil, status.Errorf(codes.Internal, "failed finding original: %s", err)
 	}
 
-	klog.V(4).InfoS("Existing volume found, comparing values", "name", req.GetName(), "engine_identifier", original.Identifier)
+	logger.V(4).Info("Existing volume found, comparing values", "name", req.GetName(), "engine_identifier", original.Identifier)
 	if original.Size != sizeFromCapacityRange(req.GetCapacityRange()) {
-		klog.V(4).Info("A volume with the same name, but a different capacity range already exists at the Anexia Engine")
+		logger.V(4).Info("A volume with the same name, but a different capacity range already exists at the Anexia Engine")
 		return nil, status.Error(codes.AlreadyExists, "volume with same name already exists")
 	}
 
-	klog.V(4).InfoS("Waiting for volume to transition into completion")
-	if err := gs.AwaitCompletion(ctx, engine, original); err != nil {
-		klog.V(2).ErrorS(err, "Volume did not transition into completion")
+	if !volumeMatchesContentSource(original, req.GetVolumeContentSource()) {
+		logger.V(4).Info("A volume with the same name, but a different content source already exists at the Anexia Engine")
+		return nil, status.Error(codes.AlreadyExists, "volume with same name already exists")
+	}
+
+	logger.V(4).Info("Waiting for volume to transition into completion")
+	if err := awaitCompletion(ctx, engine, original); err != nil {
+		logger.V(2).Error(err, "Volume did not transition into completion")
 		return nil, fmt.Errorf("failed awaiting completion: %w", err)
 	}
 
@@ -200,17 +348,229 @@ func findVolumeByName(ctx context.Context, engine types.API, name string) (*dyna
 	return nil, api.ErrNotFound
 }
 
+// listAnexiaVolumes returns all volumes, sorted by their identifier to have a stable
+// order for paging.
+func listAnexiaVolumes(ctx context.Context, engine types.API) ([]*dynamicvolumev1.Volume, error) {
+	var channel types.ObjectChannel
+	if err := engine.List(ctx, &dynamicvolumev1.Volume{}, api.ObjectChannel(&channel), api.FullObjects(true)); err != nil {
+		return nil, fmt.Errorf("failed listing volumes: %w", err)
+	}
+
+	var volumes []*dynamicvolumev1.Volume
+	for retriever := range channel {
+		var volume dynamicvolumev1.Volume
+		if err := retriever(&volume); err != nil {
+			return nil, fmt.Errorf("failed retrieving volume: %w", err)
+		}
+
+		volumes = append(volumes, &volume)
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Identifier < volumes[j].Identifier
+	})
+
+	return volumes, nil
+}
+
+// listedVolume is a volume listed with the API client for the referenced token.
+type listedVolume struct {
+	volume      *dynamicvolumev1.Volume
+	engine      types.API
+	credentials string
+}
+
+// listVolumesOfEngines lists the volumes of all given API clients, keyed by the reference to
+// their token, sorted by identifier. Volumes visible with several tokens are listed once,
+// preferring a token from secrets over the one from the environment, keyed by "".
+func listVolumesOfEngines(ctx context.Context, engines map[string]api.API) ([]listedVolume, error) {
+	var (
+		volumes []listedVolume
+		seen    = make(map[string]int)
+	)
+
+	for _, credentials := range slices.Sorted(maps.Keys(engines)) {
+		engineVolumes, err := listAnexiaVolumes(ctx, engines[credentials])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, volume := range engineVolumes {
+			listed := listedVolume{volume: volume, engine: engines[credentials], credentials: credentials}
+			if i, ok := seen[volume.Identifier]; ok {
+				if volumes[i].credentials == "" {
+					volumes[i] = listed
+				}
+				continue
+			}
+
+			seen[volume.Identifier] = len(volumes)
+			volumes = append(volumes, listed)
+		}
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].volume.Identifier < volumes[j].volume.Identifier
+	})
+
+	return volumes, nil
+}
+
+// volumeContextForVolume builds the volume context of an existing volume, using the
+// storage server interface with the given identifier. Queried storage server interfaces
+// are stored in the given cache.
+//
+// The mountURL is omitted if it cannot be constructed yet, e.g. because the volume
+// is still being provisioned. If no storage server interface identifier is given, the
+// first one of the volume is used.
+func volumeContextForVolume(ctx context.Context, engine types.API, volume *dynamicvolumev1.Volume, identifier string, cache map[string]*dynamicvolumev1.StorageServerInterface) (map[string]string, error) {
+	logger := klog.FromContext(ctx)
+	if identifier == "" {
+		if volume.StorageServerInterfaces == nil || len(*volume.StorageServerInterfaces) == 0 {
+			return nil, nil
+		}
+
+		identifier = (*volume.StorageServerInterfaces)[0].Identifier
+	}
+
+	storageServer, ok := cache[identifier]
+	if !ok {
+		storageServer = &dynamicvolumev1.StorageServerInterface{Identifier: identifier}
+		if err := engine.Get(ctx, storageServer); err != nil {
+			return nil, err
+		}
+		cache[identifier] = storageServer
+	}
+
+	mount, err := createMountURL(volume, storageServer)
+	if err != nil {
+		logger.V(4).Info("Mount URL of volume cannot be constructed yet", "id", volume.Identifier, "reason", err)
+		return nil, nil
+	}
+
+	return map[string]string{
+		"mountURL": mount,
+	}, nil
+}
+
+// volumeCondition maps the state of an ADV volume to a CSI volume condition.
+func volumeCondition(volume *dynamicvolumev1.Volume) *csi.VolumeCondition {
+	switch {
+	case volume.Error != "":
+		return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("ADV volume reported an error: %s", volume.Error)}
+	case volume.State.Type == gs.StateTypeError:
+		return &csi.VolumeCondition{Abnormal: true, Message: "ADV volume is in error state"}
+	}
+
+	return &csi.VolumeCondition{Abnormal: false, Message: "ADV volume is healthy"}
+}
+
+// getDynamicStorageServer resolves the storage server interface to create the volume on.
+//
+// The `csi.anx.io/storage-server-identifier` parameter can contain a comma-separated list of
+// identifiers. The first storage server interface located in one of the preferred topologies
+// of the request is chosen, falling back to the requisite ones. Without accessibility
+// requirements, the first storage server interface is used.
 func getDynamicStorageServer(ctx context.Context, engine types.API, req *csi.CreateVolumeRequest) (*dynamicvolumev1.StorageServerInterface, error) {
-	storageServer := dynamicvolumev1.StorageServerInterface{Identifier: req.Parameters["csi.anx.io/storage-server-identifier"]}
-	if err := engine.Get(ctx, &storageServer); err != nil {
-		return nil, err
+	identifiers := storageServerIdentifiers(req.Parameters["csi.anx.io/storage-server-identifier"])
+	if len(identifiers) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %s", ErrStorageServerIdentifierNotProvided)
 	}
 
-	if storageServer.IPAddress.Name == "" {
-		return nil, ErrQueryingIPAddressesFailed
+	candidates := make([]*dynamicvolumev1.StorageServerInterface, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		storageServer := dynamicvolumev1.StorageServerInterface{Identifier: identifier}
+		if err := engine.Get(ctx, &storageServer); err != nil {
+			return nil, err
+		}
+
+		if storageServer.IPAddress.Name == "" {
+			return nil, ErrQueryingIPAddressesFailed
+		}
+
+		candidates = append(candidates, &storageServer)
+	}
+
+	storageServer := selectStorageServer(candidates, req.GetAccessibilityRequirements())
+	if storageServer == nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "no storage server interface satisfies the accessibility requirements")
+	}
+
+	return storageServer, nil
+}
+
+// storageServerIdentifiers splits the comma-separated list of storage server interface
+// identifiers given as StorageClass parameter.
+func storageServerIdentifiers(parameter string) []string {
+	var identifiers []string
+	for _, identifier := range strings.Split(parameter, ",") {
+		if identifier = strings.TrimSpace(identifier); identifier != "" {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+
+	return identifiers
+}
+
+func selectStorageServer(candidates []*dynamicvolumev1.StorageServerInterface, requirement *csi.TopologyRequirement) *dynamicvolumev1.StorageServerInterface {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	topologies := make([]*csi.Topology, 0, len(requirement.GetPreferred())+len(requirement.GetRequisite()))
+	topologies = append(topologies, requirement.GetPreferred()...)
+	topologies = append(topologies, requirement.GetRequisite()...)
+	if len(topologies) == 0 {
+		return candidates[0]
+	}
+
+	for _, topology := range topologies {
+		for _, candidate := range candidates {
+			if storageServerInTopology(candidate, topology) {
+				return candidate
+			}
+		}
+	}
+
+	return nil
+}
+
+// storageServerInTopology checks if the storage server interface is located in the
+// given topology. Topologies without location segment are satisfied by any location.
+func storageServerInTopology(storageServer *dynamicvolumev1.StorageServerInterface, topology *csi.Topology) bool {
+	location, ok := topology.GetSegments()[csitypes.TopologyKeyLocation]
+	if !ok {
+		return true
+	}
+
+	return storageServer.Location.Identifier == location
+}
+
+// accessibleTopology returns the topology volumes on the given storage server interface
+// are accessible from, which is nil if its location is unknown.
+func accessibleTopology(storageServer *dynamicvolumev1.StorageServerInterface, requirements *csi.TopologyRequirement) []*csi.Topology {
+	if storageServer.Location.Identifier == "" || !requiresLocation(requirements) {
+		return nil
+	}
+
+	return []*csi.Topology{{
+		Segments: map[string]string{
+			csitypes.TopologyKeyLocation: storageServer.Location.Identifier,
+		},
+	}}
+}
+
+// requiresLocation returns true if any of the given accessibility requirements constrains the
+// location of a volume. Without such requirements, the nodes don't report a location either
+// and returning one for the volume would make it inaccessible to all of them.
+func requiresLocation(requirements *csi.TopologyRequirement) bool {
+	for _, topology := range append(requirements.GetRequisite(), requirements.GetPreferred()...) {
+		if _, ok := topology.GetSegments()[csitypes.TopologyKeyLocation]; ok {
+			return true
+		}
 	}
 
-	return &storageServer, nil
+	return false
 }
 
 // createMountURL builds the NFS mount URL that's going to be used.
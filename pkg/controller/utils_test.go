@@ -7,6 +7,7 @@ import (
 
 	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
 	"github.com/anexia/csi-driver/pkg/internal/mockapi"
+	csitypes "github.com/anexia/csi-driver/pkg/types"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
@@ -142,16 +143,53 @@ var _ = Describe("Controller Service Utils", func() {
 				return nil
 			})
 
-			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 
 			Expect(err).ToNot(HaveOccurred())
 			Expect(volume.Identifier).To(Equal("mocked-volume-identifier"))
 		})
 
+		It("uses the ADS class of the mutable parameters if given", func() {
+			req.MutableParameters = map[string]string{"csi.anx.io/ads-class": "ENT2"}
+			expectedVolumeCreate.ADSClass = "ENT2"
+			expectedVolumeAfterCreate.ADSClass = "ENT2"
+
+			a.EXPECT().Create(gomock.Any(), &expectedVolumeCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				v.Identifier = "mocked-volume-identifier"
+				return nil
+			})
+
+			// AwaitCompletion
+			a.EXPECT().Get(gomock.Any(), &expectedVolumeAfterCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+				v.State.Type = gs.StateTypeOK
+				return nil
+			})
+
+			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(volume.ADSClass).To(Equal("ENT2"))
+		})
+
+		It("returns an InvalidArgument error when no ADS class was given", func() {
+			delete(req.Parameters, "csi.anx.io/ads-class")
+
+			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(volume).To(BeNil())
+		})
+
+		It("returns an InvalidArgument error when unknown mutable parameters were given", func() {
+			req.MutableParameters = map[string]string{"csi.anx.io/foo": "bar"}
+
+			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(volume).To(BeNil())
+		})
+
 		It("returns an error when api.Create wasn't successful", func() {
 			a.EXPECT().Create(gomock.Any(), &expectedVolumeCreate).Return(api.ErrNotFound)
 
-			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+			volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 
 			Expect(err).To(MatchError(api.ErrNotFound))
 			Expect(volume).To(BeNil())
@@ -166,7 +204,7 @@ var _ = Describe("Controller Service Utils", func() {
 			// AwaitCompletion
 			a.EXPECT().Get(gomock.Any(), &expectedVolumeAfterCreate).Return(api.ErrNotFound)
 
-			_, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+			_, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 
 			Expect(err).To(MatchError(api.ErrNotFound))
 		})
@@ -185,11 +223,96 @@ var _ = Describe("Controller Service Utils", func() {
 
 			a.EXPECT().Destroy(gomock.Any(), &expectedVolumeAfterCreate).Times(1)
 
-			_, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+			_, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 
 			Expect(status.Convert(err).Message()).To(Equal("ADV volume went into error state, reprovisioning it"))
 		})
 
+		Context("with a volume content source", func() {
+			It("creates the volume from the requested snapshot", func() {
+				req.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+					Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "mocked-snapshot-identifier"},
+				}}
+				expectedVolumeCreate.Snapshot = &dynamicvolumev1.Snapshot{Identifier: "mocked-snapshot-identifier"}
+				expectedVolumeAfterCreate.Snapshot = expectedVolumeCreate.Snapshot
+
+				a.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Snapshot{Identifier: "mocked-snapshot-identifier"}).DoAndReturn(func(_ any, s *dynamicvolumev1.Snapshot, _ ...any) error {
+					s.Size = 12345
+					return nil
+				})
+
+				a.EXPECT().Create(gomock.Any(), &expectedVolumeCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.Identifier = "mocked-volume-identifier"
+					return nil
+				})
+
+				// AwaitCompletion
+				a.EXPECT().Get(gomock.Any(), &expectedVolumeAfterCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.State.Type = gs.StateTypeOK
+					return nil
+				})
+
+				volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(volume.Identifier).To(Equal("mocked-volume-identifier"))
+			})
+
+			It("clones the requested volume", func() {
+				req.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "mocked-source-volume-identifier"},
+				}}
+				expectedVolumeCreate.SourceVolume = &dynamicvolumev1.Volume{Identifier: "mocked-source-volume-identifier"}
+				expectedVolumeAfterCreate.SourceVolume = expectedVolumeCreate.SourceVolume
+
+				a.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "mocked-source-volume-identifier"}).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.Size = 12345
+					return nil
+				})
+
+				a.EXPECT().Create(gomock.Any(), &expectedVolumeCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.Identifier = "mocked-volume-identifier"
+					return nil
+				})
+
+				// AwaitCompletion
+				a.EXPECT().Get(gomock.Any(), &expectedVolumeAfterCreate).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.State.Type = gs.StateTypeOK
+					return nil
+				})
+
+				volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(volume.Identifier).To(Equal("mocked-volume-identifier"))
+			})
+
+			It("returns a NotFound error when the source snapshot does not exist", func() {
+				req.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+					Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "does-not-exist"},
+				}}
+
+				a.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Snapshot{Identifier: "does-not-exist"}).Return(api.ErrNotFound)
+
+				volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+				Expect(volume).To(BeNil())
+			})
+
+			It("returns an OutOfRange error when the source volume is larger than the requested size", func() {
+				req.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "mocked-source-volume-identifier"},
+				}}
+
+				a.EXPECT().Get(gomock.Any(), &dynamicvolumev1.Volume{Identifier: "mocked-source-volume-identifier"}).DoAndReturn(func(_ any, v *dynamicvolumev1.Volume, _ ...any) error {
+					v.Size = 54321
+					return nil
+				})
+
+				volume, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
+				Expect(status.Code(err)).To(Equal(codes.OutOfRange))
+				Expect(volume).To(BeNil())
+			})
+		})
+
 		Context("idempotency", func() {
 			BeforeEach(func() {
 				// Create succeeds
@@ -223,7 +346,7 @@ var _ = Describe("Controller Service Utils", func() {
 
 			It("returns an error when a volume with the same name but different size already exists", func() {
 				req.CapacityRange = &csi.CapacityRange{RequiredBytes: 54321}
-				v, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+				v, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 				Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
 				Expect(v).To(BeNil())
 			})
@@ -236,7 +359,7 @@ var _ = Describe("Controller Service Utils", func() {
 					return nil
 				})
 
-				v, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req)
+				v, err := createAnexiaDynamicVolumeFromRequest(context.TODO(), a, req, "mocked-storage-server-identifier", nil)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(v).ToNot(BeNil())
 				Expect(v.Identifier).To(Equal("original"))
@@ -244,6 +367,52 @@ var _ = Describe("Controller Service Utils", func() {
 		})
 	})
 
+	Context("volumeMatchesContentSource", func() {
+		snapshotSource := &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "snapshot"},
+		}}
+		volumeSource := &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{
+			Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "volume"},
+		}}
+
+		DescribeTable("compares the source of a volume", func(volume dynamicvolumev1.Volume, source *csi.VolumeContentSource, expected bool) {
+			Expect(volumeMatchesContentSource(&volume, source)).To(Equal(expected))
+		},
+			Entry("no source requested, none set", dynamicvolumev1.Volume{}, nil, true),
+			Entry("no source requested, snapshot set", dynamicvolumev1.Volume{Snapshot: &dynamicvolumev1.Snapshot{Identifier: "snapshot"}}, nil, false),
+			Entry("snapshot requested, source unknown", dynamicvolumev1.Volume{}, snapshotSource, true),
+			Entry("snapshot requested, same snapshot", dynamicvolumev1.Volume{Snapshot: &dynamicvolumev1.Snapshot{Identifier: "snapshot"}}, snapshotSource, true),
+			Entry("snapshot requested, other snapshot", dynamicvolumev1.Volume{Snapshot: &dynamicvolumev1.Snapshot{Identifier: "other"}}, snapshotSource, false),
+			Entry("volume requested, same volume", dynamicvolumev1.Volume{SourceVolume: &dynamicvolumev1.Volume{Identifier: "volume"}}, volumeSource, true),
+			Entry("volume requested, other volume", dynamicvolumev1.Volume{SourceVolume: &dynamicvolumev1.Volume{Identifier: "other"}}, volumeSource, false),
+		)
+	})
+
+	Context("volumeCondition", func() {
+		It("reports healthy volumes as normal", func() {
+			volume := dynamicvolumev1.Volume{}
+			volume.State.Type = gs.StateTypeOK
+
+			Expect(volumeCondition(&volume).Abnormal).To(BeFalse())
+		})
+
+		It("reports volumes in error state as abnormal", func() {
+			volume := dynamicvolumev1.Volume{}
+			volume.State.Type = gs.StateTypeError
+
+			Expect(volumeCondition(&volume).Abnormal).To(BeTrue())
+		})
+
+		It("reports volumes with an error message as abnormal, including the message", func() {
+			volume := dynamicvolumev1.Volume{Error: "disk on fire"}
+			volume.State.Type = gs.StateTypeOK
+
+			condition := volumeCondition(&volume)
+			Expect(condition.Abnormal).To(BeTrue())
+			Expect(condition.Message).To(ContainSubstring("disk on fire"))
+		})
+	})
+
 	Context("getDynamicStorageServer", func() {
 		It("can successfully resolve a server with valid `csi.anx.io/storage-server-identifier` set", func() {
 			a.EXPECT().Get(gomock.Any(), &dynamicvolumev1.StorageServerInterface{Identifier: "foobar"}).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
@@ -291,6 +460,88 @@ var _ = Describe("Controller Service Utils", func() {
 
 			Expect(err).To(MatchError(ErrQueryingIPAddressesFailed))
 		})
+
+		Context("with multiple storage server interfaces", func() {
+			BeforeEach(func() {
+				locations := map[string]string{"foo": "location-a", "bar": "location-b"}
+
+				a.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, s *dynamicvolumev1.StorageServerInterface, _ ...any) error {
+					s.IPAddress.Name = "127.0.0.1"
+					s.Location.Identifier = locations[s.Identifier]
+					return nil
+				}).Times(2)
+			})
+
+			topology := func(location string) *csi.Topology {
+				return &csi.Topology{Segments: map[string]string{csitypes.TopologyKeyLocation: location}}
+			}
+
+			It("uses the first one without accessibility requirements", func() {
+				storageServer, err := getDynamicStorageServer(context.TODO(), a, &csi.CreateVolumeRequest{
+					Parameters: map[string]string{
+						"csi.anx.io/storage-server-identifier": "foo, bar",
+					},
+				})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(storageServer.Identifier).To(Equal("foo"))
+				Expect(accessibleTopology(storageServer, nil)).To(BeNil())
+			})
+
+			It("reports no topology if the requirements don't constrain the location", func() {
+				requirements := &csi.TopologyRequirement{
+					Requisite: []*csi.Topology{{Segments: map[string]string{"kubernetes.io/hostname": "node-a"}}},
+				}
+
+				storageServer, err := getDynamicStorageServer(context.TODO(), a, &csi.CreateVolumeRequest{
+					Parameters: map[string]string{
+						"csi.anx.io/storage-server-identifier": "foo,bar",
+					},
+					AccessibilityRequirements: requirements,
+				})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(storageServer.Identifier).To(Equal("foo"))
+				Expect(accessibleTopology(storageServer, requirements)).To(BeNil())
+			})
+
+			It("prefers the one in a preferred topology", func() {
+				storageServer, err := getDynamicStorageServer(context.TODO(), a, &csi.CreateVolumeRequest{
+					Parameters: map[string]string{
+						"csi.anx.io/storage-server-identifier": "foo,bar",
+					},
+					AccessibilityRequirements: &csi.TopologyRequirement{
+						Requisite: []*csi.Topology{topology("location-a"), topology("location-b")},
+						Preferred: []*csi.Topology{topology("location-b")},
+					},
+				})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(storageServer.Identifier).To(Equal("bar"))
+				Expect(accessibleTopology(storageServer, &csi.TopologyRequirement{
+					Preferred: []*csi.Topology{topology("location-b")},
+				})).To(Equal([]*csi.Topology{topology("location-b")}))
+			})
+
+			It("returns a ResourceExhausted error if no topology can be satisfied", func() {
+				_, err := getDynamicStorageServer(context.TODO(), a, &csi.CreateVolumeRequest{
+					Parameters: map[string]string{
+						"csi.anx.io/storage-server-identifier": "foo,bar",
+					},
+					AccessibilityRequirements: &csi.TopologyRequirement{
+						Requisite: []*csi.Topology{topology("location-c")},
+					},
+				})
+
+				Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+			})
+		})
+
+		It("returns an InvalidArgument error if no storage server interface is configured", func() {
+			_, err := getDynamicStorageServer(context.TODO(), a, &csi.CreateVolumeRequest{})
+
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
 	})
 
 	Context("createMountURL", func() {
@@ -318,6 +569,48 @@ var _ = Describe("Controller Service Utils", func() {
 		})
 	})
 
+	Context("checkMutableParameters", func() {
+		DescribeTable("validates mutable parameters", func(parameters map[string]string, expected error) {
+			err := checkMutableParameters(parameters)
+			if expected == nil {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(expected))
+			}
+		},
+			Entry("no parameters", nil, nil),
+			Entry("valid ADS class", map[string]string{"csi.anx.io/ads-class": "ENT6"}, nil),
+			Entry("empty ADS class", map[string]string{"csi.anx.io/ads-class": ""}, ErrADSClassNotProvided),
+			Entry("storage server interface", map[string]string{"csi.anx.io/storage-server-identifier": "foo"}, ErrParameterNotMutable),
+		)
+	})
+
+	Context("paginate", func() {
+		DescribeTable("calculates the window of entries to return", func(total int, startingToken string, maxEntries int32, start, end int, nextToken string) {
+			s, e, n, err := paginate(total, startingToken, maxEntries)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(start))
+			Expect(e).To(Equal(end))
+			Expect(n).To(Equal(nextToken))
+		},
+			Entry("no entries", 0, "", int32(0), 0, 0, ""),
+			Entry("no limit", 5, "", int32(0), 0, 5, ""),
+			Entry("limit smaller than total", 5, "", int32(2), 0, 2, "2"),
+			Entry("starting token in the middle", 5, "2", int32(2), 2, 4, "4"),
+			Entry("last page", 5, "4", int32(2), 4, 5, ""),
+			Entry("limit matches exactly", 4, "2", int32(2), 2, 4, ""),
+		)
+
+		DescribeTable("rejects invalid starting tokens", func(startingToken string) {
+			_, _, _, err := paginate(5, startingToken, 0)
+			Expect(err).To(MatchError(ErrInvalidStartingToken))
+		},
+			Entry("not a number", "foo"),
+			Entry("negative", "-1"),
+			Entry("beyond the last entry", "6"),
+		)
+	})
+
 	Context("sizeFromCapacityRange", func() {
 		DescribeTable("sizeFromCapacityRange", func(capacityRange *csi.CapacityRange, expected int64) {
 			Expect(sizeFromCapacityRange(capacityRange)).To(Equal(expected))
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+)
+
+const (
+	// volumeIDVersion1 is the prefix of volume IDs in the format `v1:<volume>:<storage server interface>`,
+	// optionally followed by `:<credentials>` and `:restricted`.
+	volumeIDVersion1 = "v1"
+
+	// volumeIDRestricted is the last part of the IDs of volumes with restricted access.
+	volumeIDRestricted = "restricted"
+
+	volumeIDSeparator = ":"
+)
+
+// volumeID identifies a volume in CSI requests.
+//
+// Volumes created by earlier versions of the driver use the plain identifier of the
+// ADV volume as volume ID. Those are still accepted, but don't contain the storage
+// server interface.
+type volumeID struct {
+	// volume is the identifier of the ADV volume.
+	volume string
+
+	// storageServer is the identifier of the storage server interface the volume
+	// is mounted from, empty for volume IDs in the legacy format.
+	storageServer string
+
+	// credentials references the Engine token the volume was created with, empty for
+	// volumes managed with the token from the environment. See credentialsRef.
+	credentials string
+
+	// restrictAccess is set for volumes whose export is only accessible by the nodes they
+	// are published to, always unset for volume IDs in the legacy format.
+	restrictAccess bool
+}
+
+// volumeIDForVolume returns the ID of the given volume, using its first storage
+// server interface. Volumes with prefixes are considered to have restricted access,
+// as their export is only accessible by the prefixes.
+func volumeIDForVolume(volume *dynamicvolumev1.Volume) volumeID {
+	id := volumeID{volume: volume.Identifier}
+	if volume.StorageServerInterfaces != nil && len(*volume.StorageServerInterfaces) > 0 {
+		id.storageServer = (*volume.StorageServerInterfaces)[0].Identifier
+		id.restrictAccess = volume.Prefixes != nil && len(*volume.Prefixes) > 0
+	}
+
+	return id
+}
+
+// volumeKey returns the key of operations on the volume with the given ID.
+//
+// ListVolumes reports volumes provisioned with legacy IDs in the current format, so both IDs
+// may be used for the same volume. The key is therefore derived from the identifier of the ADV
+// volume, falling back to the given ID if it cannot be parsed.
+func volumeKey(id string) string {
+	if parsed, err := parseVolumeID(id); err == nil {
+		id = parsed.volume
+	}
+
+	return inflight.VolumeKey(id)
+}
+
+// String returns the volume ID in the format used in CSI requests.
+func (id volumeID) String() string {
+	if id.storageServer == "" {
+		return id.volume
+	}
+
+	parts := []string{volumeIDVersion1, id.volume, id.storageServer}
+	if id.credentials != "" {
+		parts = append(parts, id.credentials)
+	}
+	if id.restrictAccess {
+		parts = append(parts, volumeIDRestricted)
+	}
+
+	return strings.Join(parts, volumeIDSeparator)
+}
+
+// parseVolumeID parses volume IDs in the current as well as the legacy format.
+func parseVolumeID(id string) (volumeID, error) {
+	if id == "" {
+		return volumeID{}, ErrVolumeIDNotProvided
+	}
+
+	version, rest, found := strings.Cut(id, volumeIDSeparator)
+	if !found {
+		// ADV identifiers never contain the separator, so this is a legacy volume ID.
+		return volumeID{volume: id}, nil
+	}
+
+	if version != volumeIDVersion1 {
+		return volumeID{}, fmt.Errorf("%w: unsupported version %q", ErrInvalidVolumeID, version)
+	}
+
+	parts := strings.Split(rest, volumeIDSeparator)
+	if len(parts) < 2 || len(parts) > 4 || slices.Contains(parts, "") {
+		return volumeID{}, fmt.Errorf("%w: %q", ErrInvalidVolumeID, id)
+	}
+
+	parsed := volumeID{volume: parts[0], storageServer: parts[1]}
+	if parts[len(parts)-1] == volumeIDRestricted {
+		parsed.restrictAccess = true
+		parts = parts[:len(parts)-1]
+	}
+
+	switch len(parts) {
+	case 2:
+	case 3:
+		parsed.credentials = parts[2]
+	default:
+		return volumeID{}, fmt.Errorf("%w: %q", ErrInvalidVolumeID, id)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	dynamicvolumev1 "github.com/anexia/csi-driver/pkg/internal/apis/dynamicvolume/v1"
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Volume IDs", func() {
+	DescribeTable("parseVolumeID",
+		func(id string, expected volumeID, expectedErr error) {
+			parsed, err := parseVolumeID(id)
+			if expectedErr != nil {
+				Expect(err).To(MatchError(expectedErr))
+				return
+			}
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(expected))
+			Expect(parsed.String()).To(Equal(id))
+		},
+		Entry("current format", "v1:volume:storage-server", volumeID{volume: "volume", storageServer: "storage-server"}, nil),
+		Entry("with credentials", "v1:volume:storage-server:0123456789abcdef", volumeID{volume: "volume", storageServer: "storage-server", credentials: "0123456789abcdef"}, nil),
+		Entry("with restricted access", "v1:volume:storage-server:restricted", volumeID{volume: "volume", storageServer: "storage-server", restrictAccess: true}, nil),
+		Entry("with credentials and restricted access", "v1:volume:storage-server:0123456789abcdef:restricted", volumeID{volume: "volume", storageServer: "storage-server", credentials: "0123456789abcdef", restrictAccess: true}, nil),
+		Entry("legacy format", "volume", volumeID{volume: "volume"}, nil),
+		Entry("empty", "", volumeID{}, ErrVolumeIDNotProvided),
+		Entry("unsupported version", "v2:volume:storage-server", volumeID{}, ErrInvalidVolumeID),
+		Entry("missing storage server interface", "v1:volume", volumeID{}, ErrInvalidVolumeID),
+		Entry("empty volume", "v1::storage-server", volumeID{}, ErrInvalidVolumeID),
+		Entry("empty credentials", "v1:volume:storage-server:", volumeID{}, ErrInvalidVolumeID),
+		Entry("too many parts", "v1:volume:storage-server:credentials:foo", volumeID{}, ErrInvalidVolumeID),
+		Entry("restricted access without storage server interface", "v1:volume:restricted", volumeID{}, ErrInvalidVolumeID),
+	)
+
+	It("derives the same key for the current and the legacy format of a volume", func() {
+		Expect(volumeKey("v1:volume:storage-server:0123456789abcdef")).To(Equal(volumeKey("volume")))
+		Expect(volumeKey("v1:volume:storage-server")).ToNot(Equal(volumeKey("v1:other:storage-server")))
+		Expect(volumeKey("v2:volume:storage-server")).To(Equal(inflight.VolumeKey("v2:volume:storage-server")))
+	})
+
+	It("uses the first storage server interface of a volume", func() {
+		id := volumeIDForVolume(&dynamicvolumev1.Volume{
+			Identifier:              "volume",
+			StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "first"}, {Identifier: "second"}},
+		})
+		Expect(id.String()).To(Equal("v1:volume:first"))
+	})
+
+	It("marks volumes with prefixes as restricted", func() {
+		id := volumeIDForVolume(&dynamicvolumev1.Volume{
+			Identifier:              "volume",
+			StorageServerInterfaces: &[]dynamicvolumev1.StorageServerInterface{{Identifier: "storage-server"}},
+			Prefixes:                &[]dynamicvolumev1.Prefix{{Identifier: "prefix"}},
+		})
+		Expect(id.String()).To(Equal("v1:volume:storage-server:restricted"))
+	})
+
+	It("returns the legacy format for volumes without storage server interface", func() {
+		id := volumeIDForVolume(&dynamicvolumev1.Volume{Identifier: "volume"})
+		Expect(id.String()).To(Equal("volume"))
+	})
+})
@@ -3,39 +3,139 @@ package driver
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"time"
+
+	"k8s.io/klog/v2"
 
 	"github.com/anexia/csi-driver/pkg/controller"
 	"github.com/anexia/csi-driver/pkg/identity"
+	"github.com/anexia/csi-driver/pkg/internal/tracing"
 	"github.com/anexia/csi-driver/pkg/node"
 	"github.com/anexia/csi-driver/pkg/server"
 	"github.com/anexia/csi-driver/pkg/types"
 )
 
+// Options configures the csi-driver instance to run.
+type Options struct {
+	Components types.Components
+	Endpoint   string
+
+	// DrainTimeout is the time to wait for requests in progress when stopping, see server.Options.
+	DrainTimeout time.Duration
+
+	// TLS and AllowInsecureTCP configure TLS for the endpoint, see server.Options.
+	TLS              server.TLSOptions
+	AllowInsecureTCP bool
+
+	// MetricsAddress is the address to serve the Prometheus metrics on, see server.Options.
+	MetricsAddress string
+
+	// HealthAddress is the address to serve /healthz and /readyz on, see server.Options.
+	HealthAddress string
+
+	// TracingEndpoint, TracingInsecure and TracingSampleRatio configure exporting traces
+	// with OTLP, not exported if no endpoint is set.
+	TracingEndpoint    string
+	TracingInsecure    bool
+	TracingSampleRatio float64
+
+	NodeID   string
+	Location string
+
+	// NodeIP is the IP address the node accesses the NFS exports with. If valid, it's
+	// encoded into the node ID to allow publishing volumes with restricted access.
+	NodeIP netip.Addr
+
+	// VolumeProbeTimeout and RemountStaleVolumes configure the volume health detection
+	// of the node component, see node.Options.
+	VolumeProbeTimeout  time.Duration
+	RemountStaleVolumes bool
+
+	// AllowedMountOptions and DeniedMountOptions restrict the mount options accepted
+	// by the node component, see node.Options.
+	AllowedMountOptions []string
+	DeniedMountOptions  []string
+
+	// KubeletDir is the root directory of kubelet, see node.Options.
+	KubeletDir string
+
+	// CredentialsDir is the directory with the Anexia Engine tokens of StorageClasses, see controller.Options.
+	CredentialsDir string
+}
+
 // Run initializes the csi-driver instance with the given configuration and
 // executes the main loop of the server.
-func Run(ctx context.Context, components types.Components, nodeID, endpoint string) error {
-	opts := server.Options{
-		Endpoint: endpoint,
-		NodeID:   nodeID,
+func Run(ctx context.Context, driverOpts Options) error {
+	nodeID := types.NodeID(driverOpts.NodeID, driverOpts.NodeIP)
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Endpoint:    driverOpts.TracingEndpoint,
+		Insecure:    driverOpts.TracingInsecure,
+		SampleRatio: driverOpts.TracingSampleRatio,
+	})
+	if err != nil {
+		return err
 	}
+	defer func() {
+		// the context is cancelled already when stopping
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
 
-	var err error
-	if opts.Identity, err = identity.New(components); err != nil {
-		return fmt.Errorf("error initializing identity server: %w", err)
+		if err := shutdownTracing(ctx); err != nil {
+			klog.FromContext(ctx).Error(err, "Flushing traces failed")
+		}
+	}()
+
+	opts := server.Options{
+		Endpoint:     driverOpts.Endpoint,
+		NodeID:       nodeID,
+		DrainTimeout: driverOpts.DrainTimeout,
+
+		TLS:              driverOpts.TLS,
+		AllowInsecureTCP: driverOpts.AllowInsecureTCP,
+
+		MetricsAddress: driverOpts.MetricsAddress,
+		HealthAddress:  driverOpts.HealthAddress,
 	}
 
-	if components.Has(types.Controller) {
-		if opts.Controller, err = controller.New(); err != nil {
+	if driverOpts.Components.Has(types.Controller) {
+		if opts.Controller, err = controller.New(controller.Options{CredentialsDir: driverOpts.CredentialsDir}); err != nil {
 			return fmt.Errorf("error initializing controller server: %w", err)
 		}
 	}
 
-	if components.Has(types.Node) {
-		if opts.Node, err = node.New(nodeID); err != nil {
+	if driverOpts.Components.Has(types.Node) {
+		nodeOpts := node.Options{
+			NodeID:   nodeID,
+			Location: driverOpts.Location,
+
+			VolumeProbeTimeout:  driverOpts.VolumeProbeTimeout,
+			RemountStaleVolumes: driverOpts.RemountStaleVolumes,
+
+			AllowedMountOptions: driverOpts.AllowedMountOptions,
+			DeniedMountOptions:  driverOpts.DeniedMountOptions,
+
+			KubeletDir: driverOpts.KubeletDir,
+		}
+
+		if opts.Node, err = node.New(nodeOpts); err != nil {
 			return fmt.Errorf("error initializing node server: %w", err)
 		}
 	}
 
+	// the identity component reports if the other components are ready
+	var probers []types.Prober
+	for _, component := range []any{opts.Controller, opts.Node} {
+		if prober, ok := component.(types.Prober); ok {
+			probers = append(probers, prober)
+		}
+	}
+
+	if opts.Identity, err = identity.New(driverOpts.Components, probers...); err != nil {
+		return fmt.Errorf("error initializing identity server: %w", err)
+	}
+
 	srv, err := server.New(opts)
 	if err != nil {
 		return fmt.Errorf("error initializing server: %w", err)
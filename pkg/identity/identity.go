@@ -2,33 +2,41 @@ package identity
 
 import (
 	"context"
+	"errors"
 
 	"github.com/anexia/csi-driver/pkg/types"
 	"github.com/anexia/csi-driver/pkg/version"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/klog/v2"
 )
 
 type identity struct {
 	csi.UnimplementedIdentityServer
 	components types.Components
+
+	// probers check if the enabled components are ready.
+	probers []types.Prober
 }
 
 // New creates a fresh instance of the Identitiy component, ready to register to a GRPC server.
-func New(components types.Components) (csi.IdentityServer, error) {
+// Probe reports the plugin as ready only if all given probers do.
+func New(components types.Components, probers ...types.Prober) (csi.IdentityServer, error) {
 	return identity{
 		components: components,
+		probers:    probers,
 	}, nil
 }
 
 func (is identity) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
 	return &csi.GetPluginInfoResponse{
-		Name:          "csi.anx.io",
+		Name:          types.DriverName,
 		VendorVersion: version.Version,
 	}, nil
 }
 
 func (is identity) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
-	capabilities := make([]*csi.PluginCapability, 0, 1)
+	capabilities := make([]*csi.PluginCapability, 0, 2)
 
 	if is.components.Has(types.Controller) {
 		capabilities = append(capabilities, &csi.PluginCapability{
@@ -37,6 +45,12 @@ func (is identity) GetPluginCapabilities(ctx context.Context, req *csi.GetPlugin
 					Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
 				},
 			},
+		}, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+				},
+			},
 		})
 	}
 
@@ -46,5 +60,17 @@ func (is identity) GetPluginCapabilities(ctx context.Context, req *csi.GetPlugin
 }
 
 func (is identity) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	return &csi.ProbeResponse{}, nil
+	var errs []error
+	for _, prober := range is.probers {
+		if err := prober.Probe(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		klog.FromContext(ctx).Info("Plugin is not ready", "reasons", err.Error())
+		return &csi.ProbeResponse{Ready: wrapperspb.Bool(false)}, nil
+	}
+
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(true)}, nil
 }
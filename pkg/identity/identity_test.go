@@ -0,0 +1,52 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/anexia/csi-driver/pkg/types"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+type proberFunc func(ctx context.Context) error
+
+func (f proberFunc) Probe(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	ready := proberFunc(func(context.Context) error { return nil })
+	notReady := proberFunc(func(context.Context) error { return errors.New("mock error") })
+
+	tests := []struct {
+		name     string
+		probers  []types.Prober
+		expected bool
+	}{
+		{"without probers", nil, true},
+		{"all probers ready", []types.Prober{ready, ready}, true},
+		{"one prober not ready", []types.Prober{ready, notReady}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is, err := New(types.Controller|types.Node, tt.probers...)
+			if err != nil {
+				t.Fatalf("Expected no error, got %#v", err)
+			}
+
+			resp, err := is.Probe(context.Background(), &csi.ProbeRequest{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %#v", err)
+			}
+			if resp.GetReady() == nil || resp.GetReady().GetValue() != tt.expected {
+				t.Fatalf("Expected ready %t, got %v", tt.expected, resp.GetReady())
+			}
+		})
+	}
+}
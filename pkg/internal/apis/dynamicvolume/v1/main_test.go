@@ -11,6 +11,9 @@ import (
 
 var _ types.Object = &Volume{}
 var _ types.Object = &StorageServerInterface{}
+var _ types.Object = &Snapshot{}
+var _ types.Object = &Quota{}
+var _ types.Object = &Prefix{}
 
 func TestControllerService(t *testing.T) {
 	RegisterFailHandler(Fail)
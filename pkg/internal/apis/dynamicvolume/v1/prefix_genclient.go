@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"context"
+	"net/url"
+)
+
+func (p *Prefix) FilterAPIRequestBody(ctx context.Context) (interface{}, error) {
+	return requestBody(ctx, func() interface{} {
+		return &struct {
+			commonRequestBody
+			Prefix
+		}{
+			Prefix: *p,
+		}
+	})
+}
+
+func (p *Prefix) EndpointURL(ctx context.Context) (*url.URL, error) {
+	return endpointURL(ctx, p, "/api/dynamic_volume/v1/prefixes.json")
+}
+
+func (p *Prefix) GetIdentifier(ctx context.Context) (string, error) {
+	return p.Identifier, nil
+}
@@ -0,0 +1,14 @@
+package v1
+
+import (
+	"context"
+	"net/url"
+)
+
+func (q *Quota) EndpointURL(ctx context.Context) (*url.URL, error) {
+	return endpointURL(ctx, q, "/api/dynamic_volume/v1/quotas.json")
+}
+
+func (q *Quota) GetIdentifier(ctx context.Context) (string, error) {
+	return q.Identifier, nil
+}
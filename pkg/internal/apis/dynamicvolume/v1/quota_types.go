@@ -0,0 +1,20 @@
+package v1
+
+import (
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+)
+
+// Quota describes how much storage of an ADS class can be allocated on a storage
+// server interface and how much of it is already in use.
+type Quota struct {
+	gs.GenericService
+
+	Identifier string `json:"identifier,omitempty" anxcloud:"identifier"`
+	ADSClass   string `json:"ads_class,omitempty"`
+
+	StorageServerInterface *StorageServerInterface `json:"storage_server_interface,omitempty"`
+
+	// Limit and Used are given in bytes.
+	Limit int64 `json:"limit"`
+	Used  int64 `json:"used"`
+}
@@ -0,0 +1,27 @@
+package v1
+
+import (
+	"context"
+	"net/url"
+)
+
+func (s *Snapshot) FilterAPIRequestBody(ctx context.Context) (interface{}, error) {
+	return requestBody(ctx, func() interface{} {
+		return &struct {
+			commonRequestBody
+			Snapshot
+			Volume *string `json:"volume,omitempty"`
+		}{
+			Snapshot: *s,
+			Volume:   volumeIdentifier(s.Volume),
+		}
+	})
+}
+
+func (s *Snapshot) EndpointURL(ctx context.Context) (*url.URL, error) {
+	return endpointURL(ctx, s, "/api/dynamic_volume/v1/snapshots.json")
+}
+
+func (s *Snapshot) GetIdentifier(ctx context.Context) (string, error) {
+	return s.Identifier, nil
+}
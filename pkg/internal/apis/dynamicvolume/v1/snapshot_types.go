@@ -0,0 +1,21 @@
+package v1
+
+import (
+	"time"
+
+	"go.anx.io/go-anxcloud/pkg/apis/common/gs"
+)
+
+type Snapshot struct {
+	gs.GenericService
+	gs.HasState
+
+	Identifier string `json:"identifier,omitempty" anxcloud:"identifier"`
+	Name       string `json:"name,omitempty"`
+
+	Volume *Volume `json:"volume,omitempty"`
+
+	Size      int64      `json:"size,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
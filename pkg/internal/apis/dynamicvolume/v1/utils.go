@@ -28,3 +28,21 @@ func joinPointerString(in *[]string, sep string) *string {
 	out := strings.Join(*in, sep)
 	return &out
 }
+
+// volumeIdentifier returns a pointer to the identifier of the given volume,
+// or nil if no volume is given.
+func volumeIdentifier(v *Volume) *string {
+	if v == nil {
+		return nil
+	}
+	return &v.Identifier
+}
+
+// snapshotIdentifier returns a pointer to the identifier of the given snapshot,
+// or nil if no snapshot is given.
+func snapshotIdentifier(s *Snapshot) *string {
+	if s == nil {
+		return nil
+	}
+	return &s.Identifier
+}
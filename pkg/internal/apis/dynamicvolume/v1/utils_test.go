@@ -33,4 +33,26 @@ var _ = Describe("utils", func() {
 			Expect(res).To(Equal(&expectedString))
 		})
 	})
+
+	Context("volumeIdentifier", func() {
+		It("returns nil if no volume is given", func() {
+			Expect(volumeIdentifier(nil)).To(BeNil())
+		})
+
+		It("returns a pointer to the identifier of the volume", func() {
+			identifier := "foo"
+			Expect(volumeIdentifier(&Volume{Identifier: identifier})).To(Equal(&identifier))
+		})
+	})
+
+	Context("snapshotIdentifier", func() {
+		It("returns nil if no snapshot is given", func() {
+			Expect(snapshotIdentifier(nil)).To(BeNil())
+		})
+
+		It("returns a pointer to the identifier of the snapshot", func() {
+			identifier := "foo"
+			Expect(snapshotIdentifier(&Snapshot{Identifier: identifier})).To(Equal(&identifier))
+		})
+	})
 })
@@ -12,6 +12,8 @@ func (v *Volume) FilterAPIRequestBody(ctx context.Context) (interface{}, error)
 			Volume
 			StorageServerInterfaces *string `json:"storage_server_interfaces,omitempty"`
 			Prefixes                *string `json:"prefixes,omitempty"`
+			Snapshot                *string `json:"snapshot,omitempty"`
+			SourceVolume            *string `json:"source_volume,omitempty"`
 		}{
 			Volume: *v,
 
@@ -21,6 +23,8 @@ func (v *Volume) FilterAPIRequestBody(ctx context.Context) (interface{}, error)
 			Prefixes: joinPointerString(mapPointerSlice(func(p Prefix) string {
 				return p.Identifier
 			}, v.Prefixes), ","),
+			Snapshot:     snapshotIdentifier(v.Snapshot),
+			SourceVolume: volumeIdentifier(v.SourceVolume),
 		}
 	})
 }
@@ -14,6 +14,11 @@ type Volume struct {
 	StorageServerInterfaces *[]StorageServerInterface `json:"storage_server_interfaces,omitempty"`
 	Prefixes                *[]Prefix                 `json:"prefixes,omitempty"`
 
+	// Snapshot and SourceVolume are set when creating a volume with the contents
+	// of an existing snapshot or volume.
+	Snapshot     *Snapshot `json:"snapshot,omitempty"`
+	SourceVolume *Volume   `json:"source_volume,omitempty"`
+
 	ADSClass string `json:"ads_class,omitempty"`
 	Size     int64  `json:"size,omitempty"`
 	Path     string `json:"path,omitempty"`
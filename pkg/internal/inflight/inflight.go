@@ -0,0 +1,111 @@
+// Package inflight tracks the operations in progress, so concurrent operations on the
+// same volume can be rejected as recommended by the CSI spec, or serialized where they
+// have to succeed nonetheless.
+package inflight
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VolumeNameKey returns the key of operations on the volume with the given name.
+func VolumeNameKey(name string) string {
+	return "volume-name/" + name
+}
+
+// VolumeKey returns the key of operations on the volume with the given ID.
+func VolumeKey(id string) string {
+	return "volume/" + id
+}
+
+// SnapshotKey returns the key of operations on the snapshot with the given name or ID.
+func SnapshotKey(nameOrID string) string {
+	return "snapshot/" + nameOrID
+}
+
+// TargetKey returns the key of operations on the mount at the given path.
+func TargetKey(path string) string {
+	return "target/" + path
+}
+
+// Tracker tracks operations in progress by a key, like the name or id of a volume or the path
+// it's mounted at. The zero value is ready to use.
+type Tracker struct {
+	mu         sync.Mutex
+	operations map[string]struct{}
+}
+
+// Start marks an operation on the given key as in progress. It returns an Aborted error, if
+// another operation on the same key is in progress already. Otherwise the returned function
+// must be called once the operation is done.
+func (t *Tracker) Start(key string) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.operations[key]; ok {
+		return nil, status.Errorf(codes.Aborted, "an operation on %q is already in progress", key)
+	}
+
+	if t.operations == nil {
+		t.operations = make(map[string]struct{})
+	}
+	t.operations[key] = struct{}{}
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		delete(t.operations, key)
+	}, nil
+}
+
+// Len returns the number of operations in progress.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.operations)
+}
+
+// Locker serializes operations by a key, blocking until other operations on the same key are
+// done instead of rejecting them. The zero value is ready to use.
+type Locker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock blocks until no other operation holds the lock for the given key. The returned function
+// must be called to release it once the operation is done.
+func (l *Locker) Lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
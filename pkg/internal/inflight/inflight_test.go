@@ -0,0 +1,77 @@
+package inflight
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	var tracker Tracker
+
+	done, err := tracker.Start("foo")
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+
+	if _, err := tracker.Start("foo"); status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected code Aborted for operation in progress, got %s", status.Code(err))
+	}
+
+	doneBar, err := tracker.Start("bar")
+	if err != nil {
+		t.Fatalf("Expected no error for operation on another key, got %#v", err)
+	}
+	if tracker.Len() != 2 {
+		t.Fatalf("Expected 2 operations in progress, got %d", tracker.Len())
+	}
+
+	done()
+	doneBar()
+
+	if tracker.Len() != 0 {
+		t.Fatalf("Expected no operations in progress, got %d", tracker.Len())
+	}
+	if _, err := tracker.Start("foo"); err != nil {
+		t.Fatalf("Expected no error for finished operation, got %#v", err)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	t.Parallel()
+
+	var locker Locker
+
+	unlock := locker.Lock("foo")
+
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		locker.Lock("foo")()
+	}()
+
+	// Operations on other keys are not blocked.
+	locker.Lock("bar")()
+
+	select {
+	case <-locked:
+		t.Fatalf("Expected lock on the same key to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected lock to be acquired after unlocking")
+	}
+
+	if len(locker.locks) != 0 {
+		t.Fatalf("Expected all locks to be released, got %d", len(locker.locks))
+	}
+}
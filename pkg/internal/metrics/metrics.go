@@ -0,0 +1,88 @@
+// Package metrics holds the Prometheus metrics of the driver, recorded by the components
+// and served by the server.
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.anx.io/go-anxcloud/pkg/api"
+)
+
+const namespace = "anexia_csi"
+
+// durationBuckets are the buckets of all duration histograms, ranging from fast local
+// operations to volumes taking minutes to be provisioned by the Engine.
+var durationBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	// Registry is the registry of all metrics of the driver.
+	Registry = prometheus.NewRegistry()
+
+	// GRPCRequestDuration records the duration of CSI requests by their method and gRPC code.
+	GRPCRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of CSI requests by method and gRPC code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "code"})
+
+	// EngineRequestDuration records the duration of Anexia Engine requests by their operation,
+	// resource type and result, see EngineResult.
+	EngineRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of Anexia Engine requests by operation, resource type and result.",
+		Buckets:   durationBuckets,
+	}, []string{"operation", "resource", "result"})
+
+	// MountOperationDuration records the duration of mount operations on the node by their
+	// operation and result, see Result.
+	MountOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "mount_operation_duration_seconds",
+		Help:      "Duration of mount operations by operation and result.",
+		Buckets:   durationBuckets,
+	}, []string{"operation", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GRPCRequestDuration,
+		EngineRequestDuration,
+		MountOperationDuration,
+	)
+}
+
+// Result returns the result label of an operation that returned the given error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+// EngineResult returns the result label of an Engine request that returned the given error,
+// which is the HTTP status code for errors returned by the Engine.
+func EngineResult(err error) string {
+	httpError := api.HTTPError{}
+	if errors.As(err, &httpError) {
+		return strconv.Itoa(httpError.StatusCode())
+	}
+
+	return Result(err)
+}
+
+// Since returns the seconds passed since the given time, to be observed by a histogram.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
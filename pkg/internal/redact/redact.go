@@ -0,0 +1,86 @@
+// Package redact removes secrets from CSI messages, so requests can be logged without
+// leaking the credentials passed along with them.
+package redact
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redacted replaces the values of secrets.
+const Redacted = "***redacted***"
+
+// Secrets returns a copy of the given message with all fields marked with the csi_secret
+// option redacted, recursing into nested messages. The keys of secret maps are kept.
+func Secrets(msg proto.Message) proto.Message {
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return msg
+	}
+
+	redacted := proto.Clone(msg)
+	redactMessage(redacted.ProtoReflect())
+
+	return redacted
+}
+
+func redactMessage(m protoreflect.Message) {
+	// fields are collected first, as setting fields while ranging over them is not allowed
+	var secrets, nested []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if isSecret(fd) {
+			secrets = append(secrets, fd)
+		} else if fd.Message() != nil {
+			nested = append(nested, fd)
+		}
+		return true
+	})
+
+	for _, fd := range secrets {
+		redactField(m, fd)
+	}
+
+	for _, fd := range nested {
+		switch v := m.Get(fd); {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				redactMessage(v.Message())
+				return true
+			})
+		case fd.IsList():
+			for i := range v.List().Len() {
+				redactMessage(v.List().Get(i).Message())
+			}
+		default:
+			redactMessage(v.Message())
+		}
+	}
+}
+
+// redactField replaces string values of the given field, clearing fields of other kinds.
+func redactField(m protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	switch {
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.StringKind:
+		secrets := m.Mutable(fd).Map()
+		var keys []protoreflect.MapKey
+		secrets.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		for _, k := range keys {
+			secrets.Set(k, protoreflect.ValueOfString(Redacted))
+		}
+	case !fd.IsMap() && !fd.IsList() && fd.Kind() == protoreflect.StringKind:
+		m.Set(fd, protoreflect.ValueOfString(Redacted))
+	default:
+		m.Clear(fd)
+	}
+}
+
+func isSecret(fd protoreflect.FieldDescriptor) bool {
+	secret, _ := proto.GetExtension(fd.Options(), csi.E_CsiSecret).(bool)
+	return secret
+}
@@ -0,0 +1,45 @@
+package redact
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Parallel()
+
+	req := &csi.CreateVolumeRequest{
+		Name:       "pvc-1",
+		Parameters: map[string]string{"foo": "bar"},
+		Secrets:    map[string]string{"token": "s3cr3t"},
+	}
+
+	redacted := Secrets(req).(*csi.CreateVolumeRequest)
+
+	if expected := map[string]string{"token": Redacted}; !maps.Equal(redacted.Secrets, expected) {
+		t.Fatalf("Expected secrets %v, got %v", expected, redacted.Secrets)
+	}
+	if redacted.Name != req.Name || !maps.Equal(redacted.Parameters, req.Parameters) {
+		t.Fatalf("Expected other fields to be kept, got %v", redacted)
+	}
+	if req.Secrets["token"] != "s3cr3t" {
+		t.Fatalf("Expected the original request to be unchanged, got %v", req)
+	}
+	if s := redacted.String(); strings.Contains(s, "s3cr3t") {
+		t.Fatalf("Expected the secret not to be logged, got %s", s)
+	}
+}
+
+func TestSecretsNil(t *testing.T) {
+	t.Parallel()
+
+	if redacted := Secrets(nil); redacted != nil {
+		t.Fatalf("Expected nil, got %v", redacted)
+	}
+	if redacted := Secrets((*csi.DeleteVolumeRequest)(nil)); redacted.(*csi.DeleteVolumeRequest) != nil {
+		t.Fatalf("Expected nil request, got %v", redacted)
+	}
+}
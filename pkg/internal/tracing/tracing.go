@@ -0,0 +1,85 @@
+// Package tracing creates the OpenTelemetry spans of the driver. Spans are only exported if
+// configured with Setup, otherwise the global no-op tracer provider discards them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anexia/csi-driver/pkg/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/anexia/csi-driver"
+
+// Options configures exporting traces.
+type Options struct {
+	// Endpoint is the host:port of the OTLP gRPC receiver to export traces to, not exported if empty.
+	Endpoint string
+
+	// Insecure disables TLS for the connection to the endpoint.
+	Insecure bool
+
+	// SampleRatio is the ratio of traces to sample, from 0 to 1.
+	SampleRatio float64
+}
+
+// Setup configures the global tracer provider to export traces as configured, returning a
+// function to flush the remaining spans and shut it down.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "anexia-csi-driver"),
+			attribute.String("service.version", version.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span with the given name as child of the span in the context, if any.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records the given error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Run runs f in a span with the given name and attributes, recording the error it returns.
+func Run(ctx context.Context, name string, f func(context.Context) error, attributes ...attribute.KeyValue) error {
+	ctx, span := Start(ctx, name, trace.WithAttributes(attributes...))
+	err := f(ctx)
+	End(span, err)
+
+	return err
+}
@@ -7,8 +7,14 @@ var (
 	ErrVolumeIDNotProvided = errors.New("volume id was not provided")
 	// ErrTargetPathNotProvided is returned if no target path was provided
 	ErrTargetPathNotProvided = errors.New("target path was not provided")
+	// ErrStagingTargetPathNotProvided is returned if no staging target path was provided
+	ErrStagingTargetPathNotProvided = errors.New("staging target path was not provided")
+	// ErrVolumePathNotProvided is returned if no volume path was provided
+	ErrVolumePathNotProvided = errors.New("volume path was not provided")
 	// ErrVolumeCapabilityNotProvided is returned if no volume capability was provided
 	ErrVolumeCapabilityNotProvided = errors.New("volume capability not provided")
 	// ErrMountURLNotPresentInPublishContext is returned if no mountURL is present in the PublishContext
 	ErrMountURLNotPresentInPublishContext = errors.New("mountURL not present in PublishContext")
+	// ErrMountOptionNotAllowed is returned if a mount option is denied or not in the list of allowed mount options
+	ErrMountOptionNotAllowed = errors.New("mount option not allowed")
 )
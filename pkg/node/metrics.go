@@ -0,0 +1,35 @@
+package node
+
+import (
+	"time"
+
+	"github.com/anexia/csi-driver/pkg/internal/metrics"
+	"k8s.io/mount-utils"
+)
+
+// instrumentedMounter records the duration and result of mounting and unmounting in the metrics.
+type instrumentedMounter struct {
+	mount.Interface
+}
+
+// observeMountOperation runs the given mount operation and records it.
+func observeMountOperation(operation string, f func() error) error {
+	start := time.Now()
+	err := f()
+	metrics.MountOperationDuration.WithLabelValues(operation, metrics.Result(err)).Observe(metrics.Since(start))
+
+	return err
+}
+
+func (m instrumentedMounter) Mount(source, target, fstype string, options []string) error {
+	return observeMountOperation("mount", func() error { return m.Interface.Mount(source, target, fstype, options) })
+}
+
+func (m instrumentedMounter) Unmount(target string) error {
+	return observeMountOperation("unmount", func() error { return m.Interface.Unmount(target) })
+}
+
+// instrumentedLazyUnmount detaches the mount at the given path like lazyUnmount, recording it.
+func instrumentedLazyUnmount(path string) error {
+	return observeMountOperation("lazy_unmount", func() error { return lazyUnmount(path) })
+}
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/anexia/csi-driver/pkg/types"
+)
+
+// DefaultDeniedMountOptions are the mount options rejected by default, as they change the
+// kind of mount or allow devices and setuid binaries on the volume.
+var DefaultDeniedMountOptions = []string{"bind", "rbind", "remount", "move", "suid", "dev"}
+
+// mountOptionAliases maps the names of mount options to the option configuring the same
+// behavior, so either of them overrides the other one.
+var mountOptionAliases = map[string]string{
+	"nfsvers": "vers",
+	"soft":    "hard",
+	"softerr": "hard",
+	"rw":      "ro",
+}
+
+// mountOptionPolicy decides which mount options are accepted by the node.
+type mountOptionPolicy struct {
+	// allowed are the names of the accepted mount options. All options not denied are
+	// accepted if it's empty.
+	allowed []string
+	// denied are the names of the rejected mount options.
+	denied []string
+}
+
+// validate returns an error naming the first of the given mount options that is not accepted.
+func (p mountOptionPolicy) validate(options []string) error {
+	for _, option := range options {
+		name, _, _ := strings.Cut(option, "=")
+		if slices.Contains(p.denied, name) || (len(p.allowed) > 0 && !slices.Contains(p.allowed, name)) {
+			return fmt.Errorf("%w: %q", ErrMountOptionNotAllowed, option)
+		}
+	}
+
+	return nil
+}
+
+// mountOptions returns the options to mount a volume with. The defaults given by the StorageClass
+// parameters in the volume context are overridden by the mount flags of the volume capability,
+// which are the mountOptions of the StorageClass or PersistentVolume.
+func (ns *node) mountOptions(volumeContext map[string]string, flags []string) ([]string, error) {
+	var options []string
+	if version := volumeContext[types.VolumeContextNFSVersion]; version != "" {
+		options = append(options, "vers="+version)
+	}
+	if defaults := volumeContext[types.VolumeContextMountOptions]; defaults != "" {
+		options = append(options, strings.Split(defaults, ",")...)
+	}
+	for _, flag := range flags {
+		// a single flag can contain multiple comma-separated options
+		options = append(options, strings.Split(flag, ",")...)
+	}
+
+	options = resolveMountOptions(options)
+	if err := ns.mountOptionPolicy.validate(options); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// resolveMountOptions removes empty, duplicate and conflicting mount options. Like for mount(8),
+// the last of conflicting options wins, e.g. `rw` for `ro,rw`.
+func resolveMountOptions(options []string) []string {
+	resolved := make([]string, 0, len(options))
+	seen := map[string]bool{}
+
+	for _, option := range slices.Backward(options) {
+		option = strings.TrimSpace(option)
+		if option == "" || seen[mountOptionName(option)] {
+			continue
+		}
+
+		seen[mountOptionName(option)] = true
+		resolved = append(resolved, option)
+	}
+
+	slices.Reverse(resolved)
+	return resolved
+}
+
+// mountOptionName returns the name of the given mount option, with its value and negation
+// removed, e.g. `lock` for `nolock` and `vers` for `nfsvers=4.1`.
+func mountOptionName(option string) string {
+	name, _, _ := strings.Cut(option, "=")
+	if alias, ok := mountOptionAliases[name]; ok {
+		return alias
+	}
+
+	return strings.TrimPrefix(name, "no")
+}
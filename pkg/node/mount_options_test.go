@@ -0,0 +1,54 @@
+package node
+
+import (
+	"github.com/anexia/csi-driver/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("mountOptions", func() {
+	DescribeTable("merges the defaults of the volume context with the mount flags",
+		func(volumeContext map[string]string, flags []string, expected []string) {
+			n := &node{}
+			Expect(n.mountOptions(volumeContext, flags)).To(Equal(expected))
+		},
+		Entry("no defaults and flags", nil, nil, []string{}),
+		Entry("only flags", nil, []string{"nolock"}, []string{"nolock"}),
+		Entry("only defaults",
+			map[string]string{types.VolumeContextNFSVersion: "4.1", types.VolumeContextMountOptions: "hard,timeo=600"},
+			nil,
+			[]string{"vers=4.1", "hard", "timeo=600"},
+		),
+		Entry("flags override defaults with the same name",
+			map[string]string{types.VolumeContextMountOptions: "timeo=600,lock"},
+			[]string{"timeo=100", "nolock"},
+			[]string{"timeo=100", "nolock"},
+		),
+		Entry("flags override defaults with an alias",
+			map[string]string{types.VolumeContextNFSVersion: "4.1", types.VolumeContextMountOptions: "hard,retrans=2"},
+			[]string{"nfsvers=3,soft"},
+			[]string{"retrans=2", "nfsvers=3", "soft"},
+		),
+		Entry("duplicate and conflicting flags", nil, []string{"ro", "hard", "rw", "", "hard"}, []string{"rw", "hard"}),
+	)
+
+	DescribeTable("applies the mount option policy",
+		func(policy mountOptionPolicy, flags []string, rejected string) {
+			n := &node{mountOptionPolicy: policy}
+
+			_, err := n.mountOptions(nil, flags)
+
+			if rejected == "" {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ErrMountOptionNotAllowed))
+				Expect(err).To(MatchError(ContainSubstring(rejected)))
+			}
+		},
+		Entry("denied option", mountOptionPolicy{denied: DefaultDeniedMountOptions}, []string{"nolock", "suid"}, `"suid"`),
+		Entry("negation of denied option", mountOptionPolicy{denied: DefaultDeniedMountOptions}, []string{"nosuid", "nodev"}, ""),
+		Entry("allowed options", mountOptionPolicy{allowed: []string{"vers", "nolock"}}, []string{"vers=4.2", "nolock"}, ""),
+		Entry("option not allowed", mountOptionPolicy{allowed: []string{"vers", "nolock"}}, []string{"vers=4.2", "noac"}, `"noac"`),
+		Entry("denied option in allowed list", mountOptionPolicy{allowed: []string{"bind"}, denied: []string{"bind"}}, []string{"bind"}, `"bind"`),
+	)
+})
@@ -3,8 +3,16 @@ package node
 import (
 	"context"
 	"os"
+	"os/exec"
+	"sync"
+	"time"
 
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/internal/redact"
+	"github.com/anexia/csi-driver/pkg/internal/tracing"
+	"github.com/anexia/csi-driver/pkg/types"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -15,100 +23,347 @@ import (
 type node struct {
 	csi.UnimplementedNodeServer
 
-	nodeID  string
-	mounter mount.Interface
+	nodeID   string
+	location string
+	mounter  mount.Interface
+
+	probeTimeout        time.Duration
+	remountStaleVolumes bool
+	lazyUnmount         func(path string) error
+
+	// lookPath searches the executables required to mount NFS exports when probed.
+	lookPath func(file string) (string, error)
+
+	// probes are the volume probes in progress, keyed by path.
+	probes      map[string]*pendingProbe
+	probesMutex sync.Mutex
+
+	// abnormalVolumes tracks volumes, whose remount failed.
+	abnormalVolumes abnormalVolumes
+
+	mountOptionPolicy mountOptionPolicy
+
+	// inflight tracks the operations in progress, to reject concurrent operations on the same volume.
+	inflight inflight.Tracker
+}
+
+// Options configures a Node component to create.
+type Options struct {
+	NodeID string
+
+	// Location is the identifier of the Anexia Engine location the node is running in.
+	// It's reported as topology segment, if set.
+	Location string
+
+	// VolumeProbeTimeout is the time after which a volume, whose file system statistics
+	// cannot be retrieved, is reported as abnormal. Defaults to 5 seconds.
+	VolumeProbeTimeout time.Duration
+
+	// RemountStaleVolumes enables replacing the mounts of volumes, which are reported
+	// as abnormal, e.g. because of stale NFS file handles.
+	RemountStaleVolumes bool
+
+	// AllowedMountOptions are the names of the mount options accepted for volumes. All
+	// options not denied are accepted if it's empty.
+	AllowedMountOptions []string
+
+	// DeniedMountOptions are the names of the mount options rejected for volumes,
+	// see also DefaultDeniedMountOptions.
+	DeniedMountOptions []string
+
+	// KubeletDir is the root directory of kubelet, in which orphaned volume mounts are
+	// cleaned up in the background when starting. Mounts are not reconciled if it's empty.
+	KubeletDir string
 }
 
 // New creates a fresh instance of the Node component, ready to register to a GRPC server.
-func New(nodeID string) (csi.NodeServer, error) {
-	if nodeID == "" {
+func New(opts Options) (csi.NodeServer, error) {
+	if opts.NodeID == "" {
 		klog.V(0).InfoS("The nodeID of this server is empty. This can lead to unexpected behaviour.")
 	}
 
-	return &node{
-		nodeID:  nodeID,
-		mounter: mount.New(""),
-	}, nil
+	ns := &node{
+		nodeID:   opts.NodeID,
+		location: opts.Location,
+		mounter:  instrumentedMounter{mount.New("")},
+
+		probeTimeout:        opts.VolumeProbeTimeout,
+		remountStaleVolumes: opts.RemountStaleVolumes,
+		lazyUnmount:         instrumentedLazyUnmount,
+
+		lookPath: exec.LookPath,
+
+		mountOptionPolicy: mountOptionPolicy{
+			allowed: opts.AllowedMountOptions,
+			denied:  opts.DeniedMountOptions,
+		},
+	}
+
+	if opts.KubeletDir != "" {
+		// Probing hung mounts takes up to the probe timeout each, so mounts are reconciled
+		// while serving requests already.
+		go ns.reconcileMounts(opts.KubeletDir)
+	}
+
+	return ns, nil
 }
 
-func (ns node) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+func (ns *node) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
 	return &csi.NodeGetCapabilitiesResponse{
-		Capabilities: []*csi.NodeServiceCapability{},
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
+		},
 	}, nil
 }
 
-func (ns node) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	return &csi.NodeGetInfoResponse{
+func (ns *node) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	resp := &csi.NodeGetInfoResponse{
 		NodeId: ns.nodeID,
-	}, nil
+	}
+
+	if ns.location != "" {
+		resp.AccessibleTopology = &csi.Topology{
+			Segments: map[string]string{
+				types.TopologyKeyLocation: ns.location,
+			},
+		}
+	}
+
+	return resp, nil
+}
+
+func (ns *node) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Trying to stage volume", "id", req.VolumeId, "path", req.GetStagingTargetPath())
+
+	if err := checkNodeStageVolumeRequest(req); err != nil {
+		logger.Error(err, "NodeStageVolumeRequest invalid")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid NodeStageVolumeRequest: %s", err)
+	}
+
+	done, err := ns.inflight.Start(inflight.VolumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	// the staging path is locked as well, as it may be reconciled concurrently
+	doneStaging, err := ns.inflight.Start(inflight.TargetKey(req.GetStagingTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer doneStaging()
+
+	opts, err := ns.mountOptions(req.GetVolumeContext(), req.GetVolumeCapability().GetMount().GetMountFlags())
+	if err != nil {
+		logger.V(2).Error(err, "Mount options invalid", "id", req.VolumeId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mount options: %s", err)
+	}
+
+	logger.V(3).Info("Validating staging target path")
+	notMount, err := ns.prepareMountPoint(ctx, req.GetStagingTargetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	if !notMount {
+		logger.V(2).Info("Mount already present at staging target path", "staging_target_path", req.GetStagingTargetPath())
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	logger.V(2).Info("Mounting volume to staging target path", "id", req.VolumeId)
+	mountURL, _ := mountURLFromRequest(req)
+	err = tracing.Run(ctx, "mount", func(context.Context) error {
+		return ns.mounter.Mount(mountURL, req.GetStagingTargetPath(), "nfs", opts)
+	}, attribute.String("mount.target", req.GetStagingTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Mounting volume failed", "staging_target_path", req.GetStagingTargetPath())
+		return nil, status.Errorf(codes.Internal, "error mounting volume: %s", err)
+	}
+
+	ns.abnormalVolumes.clear(req.GetVolumeId())
+
+	logger.V(4).Info("Volume staged successfully", "id", req.VolumeId)
+	return &csi.NodeStageVolumeResponse{}, nil
 }
 
-func (ns node) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
-	klog.V(2).InfoS("Trying to mount volume", "id", req.VolumeId, "path", req.GetTargetPath())
+func (ns *node) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info(
+		"Trying to unstage volume",
+		"id", req.VolumeId,
+		"path", req.GetStagingTargetPath(),
+	)
+
+	if err := checkNodeUnstageVolumeRequest(req); err != nil {
+		logger.V(4).Error(err, "NodeUnstageVolumeRequest invalid", "request", redact.Secrets(req))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid NodeUnstageVolumeRequest: %s", err)
+	}
+
+	done, err := ns.inflight.Start(inflight.VolumeKey(req.GetVolumeId()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	// the staging path is locked as well, as it may be reconciled concurrently
+	doneStaging, err := ns.inflight.Start(inflight.TargetKey(req.GetStagingTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer doneStaging()
+
+	logger.V(4).Info("Cleaning up staging path")
+	err = tracing.Run(ctx, "unmount", func(context.Context) error {
+		return mount.CleanupMountPoint(req.GetStagingTargetPath(), ns.mounter, true)
+	}, attribute.String("mount.target", req.GetStagingTargetPath()))
+	if err != nil {
+		logger.V(4).Error(err, "Cleaning up staging path failed")
+		return nil, status.Errorf(codes.Internal, "error cleaning up staging mount point: %s", err)
+	}
+
+	ns.abnormalVolumes.clear(req.GetVolumeId())
+
+	logger.V(4).Info("Volume successfully unstaged")
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+func (ns *node) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(2).Info("Trying to mount volume", "id", req.VolumeId, "path", req.GetTargetPath())
 
 	if err := checkNodePublishVolumeRequest(req); err != nil {
-		klog.ErrorS(err, "NodePublishVolumeRequest invalid")
+		logger.Error(err, "NodePublishVolumeRequest invalid")
 		return nil, status.Errorf(codes.InvalidArgument, "invalid NodePublishVolumeRequest: %s", err)
 	}
 
-	opts := req.GetVolumeCapability().GetMount().GetMountFlags()
+	done, err := ns.inflight.Start(inflight.TargetKey(req.GetTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	// Bind mounting an unmounted staging target path would silently publish an empty directory.
+	stagingNotMount, err := ns.mounter.IsLikelyNotMountPoint(req.GetStagingTargetPath())
+	if err != nil && !os.IsNotExist(err) {
+		logger.V(2).Error(err, "Not possible to validate whether the staging target path is a mount", "staging_target_path", req.GetStagingTargetPath())
+		return nil, status.Errorf(codes.Internal, "error checking if staging target path is mount: %q", err)
+	}
+	if err != nil || stagingNotMount {
+		logger.V(2).Info("Volume is not staged", "id", req.VolumeId, "staging_target_path", req.GetStagingTargetPath())
+		return nil, status.Errorf(codes.FailedPrecondition, "volume is not staged at %q", req.GetStagingTargetPath())
+	}
+
+	// the NFS export is mounted once per node at the staging target path, every pod gets a bind mount of it
+	opts := []string{"bind"}
 	if req.GetReadonly() {
-		klog.V(2).InfoS("Volume will be mounted as read-only", "id", req.VolumeId)
+		logger.V(2).Info("Volume will be mounted as read-only", "id", req.VolumeId)
 		opts = append(opts, "ro")
 	}
 
-	klog.V(3).InfoS("Validating target path")
-	// adapted from https://github.com/kubernetes-csi/csi-driver-nfs/blob/f084312ad0a3c05b720466db7f8721db2aec6a66/pkg/nfs/nodeserver.go#L108
-	notMount, err := ns.mounter.IsLikelyNotMountPoint(req.GetTargetPath())
+	logger.V(3).Info("Validating target path")
+	notMount, err := ns.prepareMountPoint(ctx, req.GetTargetPath())
 	if err != nil {
-		if os.IsNotExist(err) {
-			klog.V(3).InfoS("Creating new directory at target path", "target_path", req.GetTargetPath())
-			if err := os.Mkdir(req.GetTargetPath(), os.FileMode(os.ModeDir)); err != nil {
-				klog.V(2).ErrorS(err, "Creating a directory at path failed, cannot mount PVC", "target_path", req.GetTargetPath())
-				return nil, status.Errorf(codes.Internal, "error creating target directory: %q", err)
-			}
-
-			notMount = true
-		} else {
-			klog.V(2).ErrorS(err, "Not possible to validate whether the target path is a mount", "target_path", req.GetTargetPath())
-			return nil, status.Errorf(codes.Internal, "error checking if target path is mount: %q", err)
-		}
+		return nil, err
 	}
 
 	if !notMount {
-		klog.V(2).Infof("NodePublishVolume: Mount already present at target path %q.", req.TargetPath)
+		logger.V(2).Info("Mount already present at target path", "target_path", req.GetTargetPath())
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
-	klog.V(2).InfoS("Mounting volume to target path", "id", req.VolumeId)
-	mountURL := req.GetVolumeContext()["mountURL"]
-	if err := ns.mounter.Mount(mountURL, req.GetTargetPath(), "nfs", opts); err != nil {
-		klog.V(2).ErrorS(err, "Mounting volume failed", "target_path", req.GetTargetPath())
+	logger.V(2).Info("Bind mounting volume to target path", "id", req.VolumeId)
+	err = tracing.Run(ctx, "mount", func(context.Context) error {
+		return ns.mounter.Mount(req.GetStagingTargetPath(), req.GetTargetPath(), "", opts)
+	}, attribute.String("mount.target", req.GetTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Mounting volume failed", "target_path", req.GetTargetPath())
 		return nil, status.Errorf(codes.Internal, "error mounting volume: %s", err)
 	}
 
-	klog.V(4).InfoS("Volume mounted successfully", "id", req.VolumeId)
+	logger.V(4).Info("Volume mounted successfully", "id", req.VolumeId)
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (ns node) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
-	klog.V(4).InfoS(
+func (ns *node) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info(
 		"Trying to unmount volume",
 		"id", req.VolumeId,
 		"path", req.GetTargetPath(),
 	)
 
 	if err := checkNodeUnpublishVolumeRequest(req); err != nil {
-		klog.V(4).ErrorS(err, "NodeUnpublishVolumeRequest invalid", "request", req)
+		logger.V(4).Error(err, "NodeUnpublishVolumeRequest invalid", "request", redact.Secrets(req))
 		return nil, status.Errorf(codes.InvalidArgument, "invalid NodeUnpublishVolumeRequest: %s", err)
 	}
 
-	klog.V(4).Info("Cleaning up mount path")
-	if err := mount.CleanupMountPoint(req.GetTargetPath(), ns.mounter, true); err != nil {
-		klog.V(4).ErrorS(err, "Cleaning up mount path failed")
+	done, err := ns.inflight.Start(inflight.TargetKey(req.GetTargetPath()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	defer done()
+
+	logger.V(4).Info("Cleaning up mount path")
+	err = tracing.Run(ctx, "unmount", func(context.Context) error {
+		return mount.CleanupMountPoint(req.GetTargetPath(), ns.mounter, true)
+	}, attribute.String("mount.target", req.GetTargetPath()))
+	if err != nil {
+		logger.V(4).Error(err, "Cleaning up mount path failed")
 		return nil, status.Errorf(codes.Internal, "error cleaning up mount point: %s", err)
 	}
 
-	klog.V(4).Info("Volume successfully unmounted")
+	logger.V(4).Info("Volume successfully unmounted")
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
+
+// prepareMountPoint creates the directory at the given path, if it doesn't exist yet, and
+// returns if it's not a mount point already.
+func (ns *node) prepareMountPoint(ctx context.Context, path string) (bool, error) {
+	logger := klog.FromContext(ctx)
+
+	// adapted from https://github.com/kubernetes-csi/csi-driver-nfs/blob/f084312ad0a3c05b720466db7f8721db2aec6a66/pkg/nfs/nodeserver.go#L108
+	notMount, err := ns.mounter.IsLikelyNotMountPoint(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.V(3).Info("Creating new directory at path", "path", path)
+			if err := os.Mkdir(path, os.FileMode(os.ModeDir)); err != nil {
+				logger.V(2).Error(err, "Creating a directory at path failed, cannot mount PVC", "path", path)
+				return false, status.Errorf(codes.Internal, "error creating target directory: %q", err)
+			}
+
+			return true, nil
+		}
+
+		logger.V(2).Error(err, "Not possible to validate whether the path is a mount", "path", path)
+		return false, status.Errorf(codes.Internal, "error checking if target path is mount: %q", err)
+	}
+
+	return notMount, nil
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
 
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/types"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -32,29 +35,180 @@ var _ = Describe("Node Service", func() {
 		capabilities, err := n.NodeGetCapabilities(context.TODO(), &csi.NodeGetCapabilitiesRequest{})
 
 		Expect(err).ToNot(HaveOccurred())
-		Expect(capabilities.Capabilities).To(HaveLen(0))
+		Expect(capabilities.Capabilities).To(HaveLen(3))
+		Expect(capabilities.Capabilities[0].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME))
+		Expect(capabilities.Capabilities[1].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS))
+		Expect(capabilities.Capabilities[2].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_VOLUME_CONDITION))
+	})
+
+	Context("NodeStageVolume", func() {
+		var (
+			stagingTargetPath string
+			validRequest      *csi.NodeStageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			stagingTargetPath = GinkgoT().TempDir()
+			validRequest = &csi.NodeStageVolumeRequest{
+				VolumeId:          "foo",
+				StagingTargetPath: stagingTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"nolock"}},
+					},
+				},
+				VolumeContext: map[string]string{
+					"mountURL": "mock-server.test:/foo/bar",
+				},
+			}
+		})
+
+		It("mounts successfully", func() {
+			mounter := mount.NewFakeMounter(nil)
+			n := &node{mounter: mounter}
+
+			_, err := n.NodeStageVolume(context.TODO(), validRequest)
+
+			Expect(err).ToNot(HaveOccurred())
+
+			mounts, err := mounter.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounts).To(HaveLen(1))
+			Expect(mounts[0].Type).To(Equal("nfs"))
+			Expect(mounts[0].Path).To(Equal(stagingTargetPath))
+			Expect(mounts[0].Device).To(Equal("mock-server.test:/foo/bar"))
+			Expect(mounts[0].Opts).To(ContainElement("nolock"))
+		})
+
+		It("mounts with the default mount options of the volume context", func() {
+			validRequest.VolumeContext[types.VolumeContextNFSVersion] = "4.2"
+			validRequest.VolumeContext[types.VolumeContextMountOptions] = "lock,timeo=600"
+			mounter := mount.NewFakeMounter(nil)
+			n := &node{mounter: mounter}
+
+			_, err := n.NodeStageVolume(context.TODO(), validRequest)
+
+			Expect(err).ToNot(HaveOccurred())
+			mounts, err := mounter.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounts).To(HaveLen(1))
+			Expect(mounts[0].Opts).To(Equal([]string{"vers=4.2", "timeo=600", "nolock"}))
+		})
+
+		It("doesn't mount again if the volume is already staged", func() {
+			mounter := mount.NewFakeMounter([]mount.MountPoint{
+				{Device: "mock-server.test:/foo/bar", Path: stagingTargetPath, Type: "nfs"},
+			})
+			n := &node{mounter: mounter}
+
+			_, err := n.NodeStageVolume(context.TODO(), validRequest)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.GetLog()).To(BeEmpty())
+		})
+
+		It("returns an InvalidArgument error when the request check failed", func() {
+			n := &node{}
+
+			_, err := n.NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{})
+
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("returns an InvalidArgument error for mount options not allowed", func() {
+			validRequest.VolumeCapability.GetMount().MountFlags = []string{"suid"}
+			n := &node{mounter: mount.NewFakeMounter(nil), mountOptionPolicy: mountOptionPolicy{denied: DefaultDeniedMountOptions}}
+
+			_, err := n.NodeStageVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err).To(MatchError(ContainSubstring(`"suid"`)))
+		})
+
+		It("returns an Internal error when the mount operation failed", func() {
+			n := &node{mounter: &failingMounter{mount.NewFakeMounter(nil)}}
+
+			_, err := n.NodeStageVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+
+	Context("NodeUnstageVolume", func() {
+		var (
+			validRequest      *csi.NodeUnstageVolumeRequest
+			stagingTargetPath string
+		)
+
+		BeforeEach(func() {
+			stagingTargetPath = GinkgoT().TempDir()
+			validRequest = &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "foo",
+				StagingTargetPath: stagingTargetPath,
+			}
+		})
+
+		It("succeeds with a valid request", func() {
+			mounter := mount.NewFakeMounter([]mount.MountPoint{
+				{Device: "foo", Path: stagingTargetPath, Type: "nfs"},
+			})
+			n := &node{mounter: mounter}
+
+			_, err := n.NodeUnstageVolume(context.TODO(), validRequest)
+
+			Expect(err).ToNot(HaveOccurred())
+			mounts, err := mounter.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounts).To(BeEmpty())
+		})
+
+		It("returns an InvalidArgument error when the request check failed", func() {
+			n := &node{}
+
+			_, err := n.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{})
+
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("returns an Internal error if the unmount operation failed", func() {
+			n := &node{mounter: &failingMounter{mount.NewFakeMounter([]mount.MountPoint{
+				{Device: "foo", Path: stagingTargetPath, Type: "nfs"},
+			})}}
+
+			_, err := n.NodeUnstageVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
 	})
 
 	Context("NodePublishVolume", func() {
 		var (
+			stagingPath  string
 			targetPath   string
 			validRequest *csi.NodePublishVolumeRequest
 		)
 
+		// stagedMounter returns a mounter with the NFS export mounted at the staging target path.
+		stagedMounter := func() *mount.FakeMounter {
+			return mount.NewFakeMounter([]mount.MountPoint{{Device: "mock-server.test:/foo/bar", Path: stagingPath, Type: "nfs"}})
+		}
+
 		BeforeEach(func() {
+			stagingPath = GinkgoT().TempDir()
 			targetPath = GinkgoT().TempDir()
 			validRequest = &csi.NodePublishVolumeRequest{
-				VolumeId:         "foo",
-				TargetPath:       targetPath,
-				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:          "foo",
+				StagingTargetPath: stagingPath,
+				TargetPath:        targetPath,
+				VolumeCapability:  &csi.VolumeCapability{},
 				VolumeContext: map[string]string{
 					"mountURL": "mock-server.test:/foo/bar",
 				},
 			}
 		})
 
-		It("mounts successfully", func() {
-			mounter := mount.NewFakeMounter(nil)
+		It("bind mounts the staging target path successfully", func() {
+			mounter := stagedMounter()
 			n := &node{mounter: mounter}
 
 			_, err := n.NodePublishVolume(context.TODO(), validRequest)
@@ -63,16 +217,16 @@ var _ = Describe("Node Service", func() {
 
 			mounts, err := mounter.List()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(mounts).To(HaveLen(1))
-			Expect(mounts[0].Type).To(Equal("nfs"))
-			Expect(mounts[0].Path).To(Equal(targetPath))
-			Expect(mounts[0].Device).To(Equal("mock-server.test:/foo/bar"))
-			Expect(mounts[0].Opts).ToNot(ContainElement("ro"))
+			Expect(mounts).To(HaveLen(2))
+			Expect(mounts[1].Path).To(Equal(targetPath))
+			Expect(mounts[1].Device).To(Equal("mock-server.test:/foo/bar"))
+			Expect(mounts[1].Opts).To(ContainElement("bind"))
+			Expect(mounts[1].Opts).ToNot(ContainElement("ro"))
 		})
 
 		It("supports readonly mounts", func() {
 			validRequest.Readonly = true
-			mounter := mount.NewFakeMounter(nil)
+			mounter := stagedMounter()
 			n := &node{mounter: mounter}
 
 			_, err := n.NodePublishVolume(context.TODO(), validRequest)
@@ -80,8 +234,29 @@ var _ = Describe("Node Service", func() {
 			Expect(err).ToNot(HaveOccurred())
 			mounts, err := mounter.List()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(mounts).To(HaveLen(1))
-			Expect(mounts[0].Opts).To(ContainElement("ro"))
+			Expect(mounts).To(HaveLen(2))
+			Expect(mounts[1].Opts).To(ContainElements("bind", "ro"))
+		})
+
+		It("returns a FailedPrecondition error when the staging target path is not mounted", func() {
+			mounter := mount.NewFakeMounter(nil)
+			n := &node{mounter: mounter}
+
+			_, err := n.NodePublishVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			mounts, err := mounter.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounts).To(BeEmpty())
+		})
+
+		It("returns a FailedPrecondition error when the staging target path does not exist", func() {
+			validRequest.StagingTargetPath = filepath.Join(stagingPath, "missing")
+			n := &node{mounter: mount.NewFakeMounter(nil)}
+
+			_, err := n.NodePublishVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
 		})
 
 		It("returns an InvalidArgument error when the request check failed", func() {
@@ -93,8 +268,19 @@ var _ = Describe("Node Service", func() {
 			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
 		})
 
+		It("returns an Aborted error when an operation on the target path is in progress", func() {
+			n := &node{mounter: mount.NewFakeMounter(nil)}
+			done, err := n.inflight.Start(inflight.TargetKey(targetPath))
+			Expect(err).ToNot(HaveOccurred())
+			defer done()
+
+			_, err = n.NodePublishVolume(context.TODO(), validRequest)
+
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
+		})
+
 		It("returns an Internal error when the mount operation failed", func() {
-			n := &node{mounter: &failingMounter{mount.NewFakeMounter(nil)}}
+			n := &node{mounter: &failingMounter{stagedMounter()}}
 
 			_, err := n.NodePublishVolume(context.TODO(), validRequest)
 
@@ -159,5 +345,24 @@ var _ = Describe("Node Service", func() {
 
 		Expect(err).ToNot(HaveOccurred())
 		Expect(nodeInfo).To(Equal(&csi.NodeGetInfoResponse{NodeId: "foo"}))
+
+		It("reports the location as topology segment", func() {
+			n := &node{nodeID: "foo", location: "location-identifier"}
+
+			nodeInfo, err := n.NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeInfo.NodeId).To(Equal("foo"))
+			Expect(nodeInfo.AccessibleTopology.Segments).To(Equal(map[string]string{types.TopologyKeyLocation: "location-identifier"}))
+		})
+
+		It("reports no topology without a location", func() {
+			n := &node{nodeID: "foo"}
+
+			nodeInfo, err := n.NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeInfo.AccessibleTopology).To(BeNil())
+		})
 	})
 })
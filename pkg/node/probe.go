@@ -0,0 +1,23 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// nfsHelpers are the executables mounting NFS exports requires: the mount helper and the
+// status monitor, which the mount helper starts for file locking with NFSv3.
+var nfsHelpers = []string{"mount.nfs", "rpc.statd"}
+
+// Probe checks that the executables required to mount NFS exports are available.
+func (ns *node) Probe(ctx context.Context) error {
+	var errs []error
+	for _, helper := range nfsHelpers {
+		if _, err := ns.lookPath(helper); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not available: %w", helper, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
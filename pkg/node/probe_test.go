@@ -0,0 +1,30 @@
+package node
+
+import (
+	"context"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Probe", func() {
+	It("is ready if the NFS helpers are available", func() {
+		n := &node{lookPath: func(file string) (string, error) { return "/sbin/" + file, nil }}
+
+		Expect(n.Probe(context.TODO())).To(Succeed())
+	})
+
+	It("reports missing NFS helpers", func() {
+		n := &node{lookPath: func(file string) (string, error) {
+			if file == "rpc.statd" {
+				return "", exec.ErrNotFound
+			}
+			return "/sbin/" + file, nil
+		}}
+
+		err := n.Probe(context.TODO())
+		Expect(err).To(MatchError(exec.ErrNotFound))
+		Expect(err).To(MatchError(ContainSubstring("rpc.statd is not available")))
+	})
+})
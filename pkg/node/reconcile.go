@@ -0,0 +1,136 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/mount-utils"
+)
+
+// volumeDataFile is the file kubelet stores the metadata of staged and published CSI volumes in,
+// next to the mount point. It's removed by kubelet when the volume is unstaged or unpublished.
+const volumeDataFile = "vol_data.json"
+
+// reconcileMounts cleans up the mounts of volumes in the kubelet directory, which have been left
+// behind because kubelet already forgot about them, e.g. when the node plugin was restarted while
+// the volume was unpublished. Corrupted mounts still known to kubelet are only reported, as they
+// are cleaned up when kubelet unpublishes them. Mounts with an operation in progress are skipped.
+func (ns *node) reconcileMounts(kubeletDir string) {
+	mountPoints, err := ns.mounter.List()
+	if err != nil {
+		klog.V(0).ErrorS(err, "Listing mount points failed, not reconciling mounts")
+		return
+	}
+
+	stagingDir := filepath.Join(kubeletDir, "plugins", "kubernetes.io", "csi", types.DriverName) + string(filepath.Separator)
+	podsDir := filepath.Join(kubeletDir, "pods") + string(filepath.Separator)
+
+	var staged, published []mount.MountPoint
+	for _, mp := range mountPoints {
+		if strings.HasPrefix(mp.Path, stagingDir) {
+			staged = append(staged, mp)
+		}
+	}
+	for _, mp := range mountPoints {
+		if strings.HasPrefix(mp.Path, podsDir) && isPublishedVolume(mp, staged) {
+			published = append(published, mp)
+		}
+	}
+
+	var cleaned, corrupted, skipped int
+
+	// published volumes first, their staged volume is only cleaned up afterwards
+	for _, mp := range append(published, staged...) {
+		done, err := ns.inflight.Start(inflight.TargetKey(mp.Path))
+		if err != nil {
+			klog.V(2).InfoS("Not reconciling volume mount with an operation in progress", "path", mp.Path)
+			skipped++
+			continue
+		}
+
+		switch ns.reconcileMount(mp) {
+		case mountCleanedUp:
+			cleaned++
+		case mountCorrupted:
+			corrupted++
+		}
+		done()
+	}
+
+	klog.V(1).InfoS("Reconciled volume mounts",
+		"staged", len(staged),
+		"published", len(published),
+		"cleaned_up", cleaned,
+		"corrupted", corrupted,
+		"skipped", skipped,
+	)
+}
+
+// mountState is the outcome of reconciling a volume mount.
+type mountState int
+
+const (
+	mountHealthy mountState = iota
+	mountCorrupted
+	mountCleanedUp
+	mountCleanupFailed
+)
+
+// reconcileMount cleans up the given volume mount if it's orphaned, reporting it if it's corrupted otherwise.
+func (ns *node) reconcileMount(mp mount.MountPoint) mountState {
+	_, probeErr := ns.probeVolumePath(mp.Path)
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(mp.Path), volumeDataFile)); err == nil {
+		if abnormalVolumeCondition(probeErr) != nil {
+			klog.V(0).ErrorS(probeErr, "Volume mount is corrupted", "path", mp.Path, "device", mp.Device)
+			return mountCorrupted
+		}
+		return mountHealthy
+	}
+
+	klog.V(1).InfoS("Cleaning up orphaned volume mount", "path", mp.Path, "device", mp.Device)
+	var err error
+	if errors.Is(probeErr, errVolumeProbeTimedOut) {
+		// cleaning up hung mounts blocks, detach them instead
+		err = ns.lazyUnmount(mp.Path)
+	} else {
+		err = mount.CleanupMountPoint(mp.Path, ns.mounter, true)
+	}
+	if err != nil {
+		klog.V(0).ErrorS(err, "Cleaning up orphaned volume mount failed", "path", mp.Path)
+		return mountCleanupFailed
+	}
+
+	return mountCleanedUp
+}
+
+// isPublishedVolume returns if the given mount point in the kubelet pods directory is a volume
+// published by this driver. It's identified by the volume data stored by kubelet or, if that's
+// gone already, by being a bind mount of a staged volume.
+func isPublishedVolume(mp mount.MountPoint, staged []mount.MountPoint) bool {
+	if filepath.Base(filepath.Dir(filepath.Dir(mp.Path))) != "kubernetes.io~csi" {
+		return false
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(mp.Path), volumeDataFile))
+	if err != nil {
+		return slices.ContainsFunc(staged, func(s mount.MountPoint) bool { return s.Device == mp.Device })
+	}
+
+	var volumeData struct {
+		DriverName string `json:"driverName"`
+	}
+	if err := json.Unmarshal(data, &volumeData); err != nil {
+		klog.V(1).ErrorS(err, "Parsing volume data failed", "path", mp.Path)
+		return false
+	}
+
+	return volumeData.DriverName == types.DriverName
+}
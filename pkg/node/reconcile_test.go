@@ -0,0 +1,95 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/mount-utils"
+)
+
+var _ = Describe("reconcileMounts", func() {
+	var kubeletDir string
+
+	// volumeMount creates the mount point directory at the given path, relative to the kubelet
+	// directory, and the volume data of kubelet next to it, if driverName is not empty.
+	volumeMount := func(path, device, driverName string) mount.MountPoint {
+		path = filepath.Join(kubeletDir, path)
+		Expect(os.MkdirAll(path, 0o750)).To(Succeed())
+
+		if driverName != "" {
+			data := []byte(`{"driverName":"` + driverName + `"}`)
+			Expect(os.WriteFile(filepath.Join(filepath.Dir(path), volumeDataFile), data, 0o600)).To(Succeed())
+		}
+
+		return mount.MountPoint{Device: device, Path: path, Type: "nfs"}
+	}
+
+	BeforeEach(func() {
+		kubeletDir = GinkgoT().TempDir()
+	})
+
+	It("cleans up orphaned mounts of this driver", func() {
+		staged := volumeMount("plugins/kubernetes.io/csi/csi.anx.io/a/globalmount", "server:/a", "csi.anx.io")
+		orphanedStaged := volumeMount("plugins/kubernetes.io/csi/csi.anx.io/b/globalmount", "server:/b", "")
+		published := volumeMount("pods/pod-1/volumes/kubernetes.io~csi/pv-a/mount", "server:/a", "csi.anx.io")
+		orphanedPublished := volumeMount("pods/pod-1/volumes/kubernetes.io~csi/pv-b/mount", "server:/b", "")
+		foreign := volumeMount("pods/pod-1/volumes/kubernetes.io~csi/pv-c/mount", "server:/c", "other.csi.test")
+		unknown := volumeMount("pods/pod-1/volumes/kubernetes.io~csi/pv-d/mount", "server:/d", "")
+
+		mounter := mount.NewFakeMounter([]mount.MountPoint{staged, orphanedStaged, published, orphanedPublished, foreign, unknown})
+		n := &node{mounter: mounter}
+
+		n.reconcileMounts(kubeletDir)
+
+		mounts, err := mounter.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mounts).To(ConsistOf(staged, published, foreign, unknown))
+		Expect(orphanedStaged.Path).ToNot(BeADirectory())
+		Expect(orphanedPublished.Path).ToNot(BeADirectory())
+	})
+
+	It("keeps corrupted mounts still known to kubelet", func() {
+		published := volumeMount("pods/pod-1/volumes/kubernetes.io~csi/pv-a/mount", "server:/a", "csi.anx.io")
+
+		fakeMounter := mount.NewFakeMounter([]mount.MountPoint{published})
+		n := &node{mounter: &staleMounter{fakeMounter}}
+
+		n.reconcileMounts(kubeletDir)
+
+		mounts, err := fakeMounter.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mounts).To(ConsistOf(published))
+	})
+
+	It("cleans up orphaned corrupted mounts", func() {
+		orphaned := volumeMount("plugins/kubernetes.io/csi/csi.anx.io/a/globalmount", "server:/a", "")
+
+		fakeMounter := mount.NewFakeMounter([]mount.MountPoint{orphaned})
+		n := &node{mounter: &staleMounter{fakeMounter}}
+
+		n.reconcileMounts(kubeletDir)
+
+		mounts, err := fakeMounter.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mounts).To(BeEmpty())
+	})
+	It("skips mounts with an operation in progress", func() {
+		orphaned := volumeMount("plugins/kubernetes.io/csi/csi.anx.io/a/globalmount", "server:/a", "")
+
+		mounter := mount.NewFakeMounter([]mount.MountPoint{orphaned})
+		n := &node{mounter: mounter}
+
+		done, err := n.inflight.Start(inflight.TargetKey(orphaned.Path))
+		Expect(err).ToNot(HaveOccurred())
+		defer done()
+
+		n.reconcileMounts(kubeletDir)
+
+		mounts, err := mounter.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mounts).To(ConsistOf(orphaned))
+	})
+})
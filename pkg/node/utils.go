@@ -17,13 +17,63 @@ func checkNodePublishVolumeRequest(req *csi.NodePublishVolumeRequest) error {
 		return ErrVolumeCapabilityNotProvided
 	}
 
-	if _, ok := req.GetVolumeContext()["mountURL"]; !ok {
+	if req.StagingTargetPath == "" {
+		return ErrStagingTargetPathNotProvided
+	}
+
+	return nil
+}
+
+func checkNodeStageVolumeRequest(req *csi.NodeStageVolumeRequest) error {
+	if req.VolumeId == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if req.StagingTargetPath == "" {
+		return ErrStagingTargetPathNotProvided
+	}
+
+	if req.VolumeCapability == nil {
+		return ErrVolumeCapabilityNotProvided
+	}
+
+	if _, ok := mountURLFromRequest(req); !ok {
 		return ErrMountURLNotPresentInPublishContext
 	}
 
 	return nil
 }
 
+func checkNodeUnstageVolumeRequest(req *csi.NodeUnstageVolumeRequest) error {
+	if req.VolumeId == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if req.StagingTargetPath == "" {
+		return ErrStagingTargetPathNotProvided
+	}
+
+	return nil
+}
+
+// volumeContextRequest is implemented by all requests carrying the volume and publish context.
+type volumeContextRequest interface {
+	GetVolumeContext() map[string]string
+	GetPublishContext() map[string]string
+}
+
+// mountURLFromRequest returns the mount URL of the volume to stage. The one in the
+// publish context is resolved by the controller when publishing the volume and therefore
+// takes precedence over the one stored in the volume context when creating the volume.
+func mountURLFromRequest(req volumeContextRequest) (string, bool) {
+	if mountURL, ok := req.GetPublishContext()["mountURL"]; ok {
+		return mountURL, true
+	}
+
+	mountURL, ok := req.GetVolumeContext()["mountURL"]
+	return mountURL, ok
+}
+
 func checkNodeUnpublishVolumeRequest(req *csi.NodeUnpublishVolumeRequest) error {
 	if req.VolumeId == "" {
 		return ErrVolumeIDNotProvided
@@ -35,3 +85,15 @@ func checkNodeUnpublishVolumeRequest(req *csi.NodeUnpublishVolumeRequest) error
 
 	return nil
 }
+
+func checkNodeGetVolumeStatsRequest(req *csi.NodeGetVolumeStatsRequest) error {
+	if req.VolumeId == "" {
+		return ErrVolumeIDNotProvided
+	}
+
+	if req.VolumePath == "" {
+		return ErrVolumePathNotProvided
+	}
+
+	return nil
+}
@@ -12,12 +12,10 @@ var _ = Describe("Node Service Utils", func() {
 		var req *csi.NodePublishVolumeRequest
 		BeforeEach(func() {
 			req = &csi.NodePublishVolumeRequest{
-				VolumeId:         "foo",
-				TargetPath:       "/foo/bar",
-				VolumeCapability: &csi.VolumeCapability{},
-				VolumeContext: map[string]string{
-					"mountURL": "baz",
-				},
+				VolumeId:          "foo",
+				StagingTargetPath: "/foo/staging",
+				TargetPath:        "/foo/bar",
+				VolumeCapability:  &csi.VolumeCapability{},
 			}
 		})
 
@@ -44,11 +42,107 @@ var _ = Describe("Node Service Utils", func() {
 			Expect(err).To(MatchError(ErrVolumeCapabilityNotProvided))
 		})
 
+		It("returns an error when no staging target path was provided", func() {
+			req.StagingTargetPath = ""
+			err := checkNodePublishVolumeRequest(req)
+			Expect(err).To(MatchError(ErrStagingTargetPathNotProvided))
+		})
+	})
+
+	Context("checkNodeStageVolumeRequest", func() {
+		var req *csi.NodeStageVolumeRequest
+		BeforeEach(func() {
+			req = &csi.NodeStageVolumeRequest{
+				VolumeId:          "foo",
+				StagingTargetPath: "/foo/staging",
+				VolumeCapability:  &csi.VolumeCapability{},
+				VolumeContext: map[string]string{
+					"mountURL": "baz",
+				},
+			}
+		})
+
+		It("returns no error if request contains all necessary data", func() {
+			err := checkNodeStageVolumeRequest(req)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns an error when no volume id was provided", func() {
+			req.VolumeId = ""
+			err := checkNodeStageVolumeRequest(req)
+			Expect(err).To(MatchError(ErrVolumeIDNotProvided))
+		})
+
+		It("returns an error when no staging target path was provided", func() {
+			req.StagingTargetPath = ""
+			err := checkNodeStageVolumeRequest(req)
+			Expect(err).To(MatchError(ErrStagingTargetPathNotProvided))
+		})
+
+		It("returns an error when no volume capability was provided", func() {
+			req.VolumeCapability = nil
+			err := checkNodeStageVolumeRequest(req)
+			Expect(err).To(MatchError(ErrVolumeCapabilityNotProvided))
+		})
+
 		It("returns an error when mountURL is not present in VolumeContext", func() {
 			req.VolumeContext = nil
-			err := checkNodePublishVolumeRequest(req)
+			err := checkNodeStageVolumeRequest(req)
 			Expect(err).To(MatchError(ErrMountURLNotPresentInPublishContext))
 		})
+
+		It("accepts a mountURL present only in PublishContext", func() {
+			req.VolumeContext = nil
+			req.PublishContext = map[string]string{"mountURL": "baz"}
+			err := checkNodeStageVolumeRequest(req)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("checkNodeUnstageVolumeRequest", func() {
+		var req *csi.NodeUnstageVolumeRequest
+		BeforeEach(func() {
+			req = &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "foo",
+				StagingTargetPath: "/foo/staging",
+			}
+		})
+
+		It("returns no error if request contains all necessary data", func() {
+			err := checkNodeUnstageVolumeRequest(req)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns an error when no volume id was provided", func() {
+			req.VolumeId = ""
+			err := checkNodeUnstageVolumeRequest(req)
+			Expect(err).To(MatchError(ErrVolumeIDNotProvided))
+		})
+
+		It("returns an error when no staging target path was provided", func() {
+			req.StagingTargetPath = ""
+			err := checkNodeUnstageVolumeRequest(req)
+			Expect(err).To(MatchError(ErrStagingTargetPathNotProvided))
+		})
+	})
+
+	Context("mountURLFromRequest", func() {
+		It("prefers the mountURL of the PublishContext", func() {
+			mountURL, ok := mountURLFromRequest(&csi.NodePublishVolumeRequest{
+				VolumeContext:  map[string]string{"mountURL": "old:/path"},
+				PublishContext: map[string]string{"mountURL": "new:/path"},
+			})
+			Expect(ok).To(BeTrue())
+			Expect(mountURL).To(Equal("new:/path"))
+		})
+
+		It("falls back to the mountURL of the VolumeContext", func() {
+			mountURL, ok := mountURLFromRequest(&csi.NodePublishVolumeRequest{
+				VolumeContext: map[string]string{"mountURL": "old:/path"},
+			})
+			Expect(ok).To(BeTrue())
+			Expect(mountURL).To(Equal("old:/path"))
+		})
 	})
 
 	Context("checkNodeUnpublishVolumeRequest", func() {
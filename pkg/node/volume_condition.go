@@ -0,0 +1,225 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+	"k8s.io/mount-utils"
+)
+
+// defaultVolumeProbeTimeout is used if no probe timeout was configured.
+const defaultVolumeProbeTimeout = 5 * time.Second
+
+// errVolumeProbeTimedOut is returned by probeVolumePath if the volume path did not respond in time,
+// which is the case for NFS mounts of unreachable servers.
+var errVolumeProbeTimedOut = errors.New("volume path did not respond in time")
+
+type volumeProbe struct {
+	notMount bool
+	stats    unix.Statfs_t
+}
+
+// pendingProbe is a probe of a volume path in progress, whose result is available once done is closed.
+type pendingProbe struct {
+	done  chan struct{}
+	probe volumeProbe
+	err   error
+}
+
+// probeVolumePath checks if the given path is a mount and retrieves its file system statistics.
+// The probe is canceled after the configured timeout, as operations on hung NFS mounts block forever.
+//
+// Probes of a hung mount only finish once it recovers, so at most one probe per path is running.
+// Further calls wait for the result of the running probe instead of starting another one.
+func (ns *node) probeVolumePath(path string) (volumeProbe, error) {
+	timeout := ns.probeTimeout
+	if timeout <= 0 {
+		timeout = defaultVolumeProbeTimeout
+	}
+
+	ns.probesMutex.Lock()
+	pending, ok := ns.probes[path]
+	if !ok {
+		pending = &pendingProbe{done: make(chan struct{})}
+		if ns.probes == nil {
+			ns.probes = make(map[string]*pendingProbe)
+		}
+		ns.probes[path] = pending
+
+		go func() {
+			pending.probe.notMount, pending.err = ns.mounter.IsLikelyNotMountPoint(path)
+			if pending.err == nil && !pending.probe.notMount {
+				pending.err = unix.Statfs(path, &pending.probe.stats)
+			}
+
+			ns.probesMutex.Lock()
+			delete(ns.probes, path)
+			ns.probesMutex.Unlock()
+
+			close(pending.done)
+		}()
+	}
+	ns.probesMutex.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending.probe, pending.err
+	case <-time.After(timeout):
+		return volumeProbe{}, fmt.Errorf("%w after %s", errVolumeProbeTimedOut, timeout)
+	}
+}
+
+// pendingProbes returns the number of probes in progress.
+func (ns *node) pendingProbes() int {
+	ns.probesMutex.Lock()
+	defer ns.probesMutex.Unlock()
+
+	return len(ns.probes)
+}
+
+// abnormalVolumeCondition returns the condition to report for a volume, whose probe failed
+// with the given error. It returns nil if the error does not indicate an unhealthy mount.
+func abnormalVolumeCondition(err error) *csi.VolumeCondition {
+	if !errors.Is(err, errVolumeProbeTimedOut) && !mount.IsCorruptedMnt(err) {
+		return nil
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message:  fmt.Sprintf("volume is not accessible: %s", err),
+	}
+}
+
+// remountVolume replaces the stale NFS mount at the staging path with a fresh one and bind mounts
+// it again to every path it was bind mounted to. The mounts are detached lazily, as unmounting a
+// hung NFS mount blocks otherwise. Running containers keep the stale mount, restarted ones get the
+// fresh mount.
+//
+// Bind mounts with an operation in progress are left alone. If remounting fails after detaching
+// the stale mounts, the volume is reported as abnormal until it's staged again.
+func (ns *node) remountVolume(ctx context.Context, volumeID, stagingPath string) error {
+	logger := klog.FromContext(ctx)
+	done, err := ns.inflight.Start(inflight.VolumeKey(volumeID))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	mountPoints, err := ns.mounter.List()
+	if err != nil {
+		return fmt.Errorf("error listing mount points: %w", err)
+	}
+
+	stagingIndex := slices.IndexFunc(mountPoints, func(mp mount.MountPoint) bool { return mp.Path == stagingPath })
+	if stagingIndex == -1 {
+		return fmt.Errorf("staging path %q is not mounted", stagingPath)
+	}
+	staged := mountPoints[stagingIndex]
+
+	// Bind mounts share the device of their source. Unlike GetMountRefs, this doesn't stat
+	// the paths, which blocks for hung mounts.
+	type bindMount struct {
+		path string
+		opts []string
+	}
+	var bindMounts []bindMount
+	for _, mp := range mountPoints {
+		if mp.Path == stagingPath || mp.Device != staged.Device {
+			continue
+		}
+
+		done, err := ns.inflight.Start(inflight.TargetKey(mp.Path))
+		if err != nil {
+			logger.V(2).Info("Not remounting bind mount with an operation in progress", "path", mp.Path)
+			continue
+		}
+		defer done()
+
+		opts := []string{"bind"}
+		if slices.Contains(mp.Opts, "ro") {
+			opts = append(opts, "ro")
+		}
+		bindMounts = append(bindMounts, bindMount{path: mp.Path, opts: opts})
+
+		if err := ns.lazyUnmount(mp.Path); err != nil {
+			return fmt.Errorf("error detaching bind mount %q: %w", mp.Path, err)
+		}
+	}
+
+	if err := ns.lazyUnmount(stagingPath); err != nil {
+		err = fmt.Errorf("error detaching staging path: %w", err)
+		ns.abnormalVolumes.set(volumeID, err)
+		return err
+	}
+
+	logger.V(2).Info("Remounting stale volume", "device", staged.Device, "staging_target_path", stagingPath)
+	if err := ns.mounter.Mount(staged.Device, stagingPath, staged.Type, staged.Opts); err != nil {
+		err = fmt.Errorf("error mounting staging path: %w", err)
+		ns.abnormalVolumes.set(volumeID, err)
+		return err
+	}
+
+	var errs []error
+	for _, bind := range bindMounts {
+		if err := ns.mounter.Mount(stagingPath, bind.path, "", bind.opts); err != nil {
+			errs = append(errs, fmt.Errorf("error bind mounting %q: %w", bind.path, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		ns.abnormalVolumes.set(volumeID, err)
+		return err
+	}
+
+	ns.abnormalVolumes.clear(volumeID)
+	return nil
+}
+
+// abnormalVolumes tracks the volumes, whose stale mounts were detached without being replaced.
+// The zero value is ready to use.
+type abnormalVolumes struct {
+	mu      sync.Mutex
+	volumes map[string]string
+}
+
+func (a *abnormalVolumes) set(volumeID string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.volumes == nil {
+		a.volumes = make(map[string]string)
+	}
+	a.volumes[volumeID] = fmt.Sprintf("remounting stale volume failed: %s", err)
+}
+
+func (a *abnormalVolumes) clear(volumeID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.volumes, volumeID)
+}
+
+// condition returns the abnormal condition of the volume, which is nil if it's not tracked.
+func (a *abnormalVolumes) condition(volumeID string) *csi.VolumeCondition {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	message, ok := a.volumes[volumeID]
+	if !ok {
+		return nil
+	}
+
+	return &csi.VolumeCondition{Abnormal: true, Message: message}
+}
+
+// lazyUnmount detaches the mount at the given path without waiting for it to become idle.
+func lazyUnmount(path string) error {
+	return unix.Unmount(path, unix.MNT_DETACH)
+}
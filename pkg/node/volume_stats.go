@@ -0,0 +1,87 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/anexia/csi-driver/pkg/internal/redact"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+func (ns *node) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	logger := klog.FromContext(ctx)
+	logger.V(4).Info("Trying to get volume stats", "id", req.VolumeId, "path", req.GetVolumePath())
+
+	if err := checkNodeGetVolumeStatsRequest(req); err != nil {
+		logger.V(4).Error(err, "NodeGetVolumeStatsRequest invalid", "request", redact.Secrets(req))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid NodeGetVolumeStatsRequest: %s", err)
+	}
+
+	// Released before remounting, which tracks all bind mounts of the volume itself.
+	done, err := ns.inflight.Start(inflight.TargetKey(req.GetVolumePath()))
+	if err != nil {
+		logger.V(2).Error(err, "Operation already in progress")
+		return nil, err
+	}
+	probe, err := ns.probeVolumePath(req.GetVolumePath())
+	done()
+
+	if condition := abnormalVolumeCondition(err); condition != nil {
+		logger.V(2).Error(err, "Volume is not accessible", "id", req.VolumeId, "volume_path", req.GetVolumePath())
+
+		if ns.remountStaleVolumes && req.GetStagingTargetPath() != "" {
+			if err := ns.remountVolume(ctx, req.GetVolumeId(), req.GetStagingTargetPath()); err != nil {
+				logger.V(2).Error(err, "Remounting volume failed", "id", req.VolumeId)
+				condition.Message = fmt.Sprintf("%s, remounting failed: %s", condition.Message, err)
+			}
+		}
+
+		return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+	} else if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "volume path %q does not exist", req.GetVolumePath())
+		}
+
+		logger.V(2).Error(err, "Retrieving file system statistics failed", "volume_path", req.GetVolumePath())
+		return nil, status.Errorf(codes.Internal, "error retrieving file system statistics: %s", err)
+	}
+
+	if probe.notMount {
+		// The stale mounts of volumes are detached when remounting them, so they aren't
+		// mounted anymore if that failed.
+		if condition := ns.abnormalVolumes.condition(req.GetVolumeId()); condition != nil {
+			return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+		}
+
+		return nil, status.Errorf(codes.NotFound, "volume path %q is not mounted", req.GetVolumePath())
+	}
+
+	stats := probe.stats
+	blockSize := int64(stats.Bsize)
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     int64(stats.Blocks) * blockSize,
+				Used:      int64(stats.Blocks-stats.Bfree) * blockSize,
+				Available: int64(stats.Bavail) * blockSize,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     int64(stats.Files),
+				Used:      int64(stats.Files - stats.Ffree),
+				Available: int64(stats.Ffree),
+			},
+		},
+		VolumeCondition: &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "volume is accessible",
+		},
+	}, nil
+}
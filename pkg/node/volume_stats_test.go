@@ -0,0 +1,258 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anexia/csi-driver/pkg/internal/inflight"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/mount-utils"
+)
+
+// staleMounter reports every path as a stale NFS mount.
+type staleMounter struct {
+	mount.Interface
+}
+
+func (sm *staleMounter) IsLikelyNotMountPoint(file string) (bool, error) {
+	return false, &os.PathError{Op: "stat", Path: file, Err: unix.ESTALE}
+}
+
+// hungMounter blocks checking mount points until unblock is closed.
+type hungMounter struct {
+	*mount.FakeMounter
+	unblock chan struct{}
+}
+
+func (hm *hungMounter) IsLikelyNotMountPoint(file string) (bool, error) {
+	<-hm.unblock
+	return true, nil
+}
+
+var _ = Describe("NodeGetVolumeStats", func() {
+	var volumePath string
+
+	BeforeEach(func() {
+		volumePath = GinkgoT().TempDir()
+	})
+
+	It("returns the usage in bytes and inodes", func() {
+		n := &node{mounter: mount.NewFakeMounter([]mount.MountPoint{
+			{Device: "foo", Path: volumePath, Type: "nfs"},
+		})}
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: volumePath,
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.Usage).To(HaveLen(2))
+
+		Expect(stats.Usage[0].Unit).To(Equal(csi.VolumeUsage_BYTES))
+		Expect(stats.Usage[0].Total).To(BeNumerically(">", 0))
+		Expect(stats.Usage[0].Used + stats.Usage[0].Available).To(BeNumerically("<=", stats.Usage[0].Total))
+
+		Expect(stats.Usage[1].Unit).To(Equal(csi.VolumeUsage_INODES))
+		Expect(stats.Usage[1].Used + stats.Usage[1].Available).To(Equal(stats.Usage[1].Total))
+
+		Expect(stats.VolumeCondition.Abnormal).To(BeFalse())
+	})
+
+	It("reports stale file handles as abnormal condition", func() {
+		n := &node{mounter: &staleMounter{mount.NewFakeMounter(nil)}}
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: volumePath,
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.Usage).To(BeEmpty())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(stats.VolumeCondition.Message).To(ContainSubstring("stale file handle"))
+	})
+
+	It("reports hung mounts as abnormal condition", func() {
+		mounter := &hungMounter{mount.NewFakeMounter(nil), make(chan struct{})}
+		DeferCleanup(func() { close(mounter.unblock) })
+		n := &node{mounter: mounter, probeTimeout: 10 * time.Millisecond}
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: volumePath,
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(stats.VolumeCondition.Message).To(ContainSubstring("did not respond"))
+	})
+
+	It("probes each path at most once at a time", func() {
+		mounter := &hungMounter{mount.NewFakeMounter(nil), make(chan struct{})}
+		n := &node{mounter: mounter, probeTimeout: 10 * time.Millisecond}
+
+		for range 3 {
+			_, err := n.probeVolumePath(volumePath)
+			Expect(err).To(MatchError(errVolumeProbeTimedOut))
+		}
+		Expect(n.pendingProbes()).To(Equal(1))
+
+		close(mounter.unblock)
+		Eventually(n.pendingProbes).Should(BeZero())
+	})
+
+	It("remounts abnormal volumes if enabled", func() {
+		stagingPath := GinkgoT().TempDir()
+		otherVolumePath := GinkgoT().TempDir()
+		fakeMounter := mount.NewFakeMounter([]mount.MountPoint{
+			{Device: "mock-server.test:/foo/bar", Path: stagingPath, Type: "nfs", Opts: []string{"vers=4.2"}},
+			{Device: "mock-server.test:/foo/bar", Path: volumePath, Opts: []string{"bind", "ro"}},
+			{Device: "mock-server.test:/foo/bar", Path: otherVolumePath, Opts: []string{"bind"}},
+			{Device: "mock-server.test:/other", Path: "/other", Type: "nfs"},
+		})
+
+		var detached []string
+		n := &node{
+			mounter:             &staleMounter{fakeMounter},
+			remountStaleVolumes: true,
+			lazyUnmount: func(path string) error {
+				detached = append(detached, path)
+				return fakeMounter.Unmount(path)
+			},
+		}
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:          "foo",
+			VolumePath:        volumePath,
+			StagingTargetPath: stagingPath,
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(detached).To(Equal([]string{volumePath, otherVolumePath, stagingPath}))
+
+		mounts, err := fakeMounter.List()
+		Expect(err).ToNot(HaveOccurred())
+		// the fake mounter resolves the device of bind mounts
+		Expect(mounts).To(ConsistOf(
+			mount.MountPoint{Device: "mock-server.test:/other", Path: "/other", Type: "nfs"},
+			mount.MountPoint{Device: "mock-server.test:/foo/bar", Path: stagingPath, Type: "nfs", Opts: []string{"vers=4.2"}},
+			mount.MountPoint{Device: "mock-server.test:/foo/bar", Path: volumePath, Opts: []string{"bind", "ro"}},
+			mount.MountPoint{Device: "mock-server.test:/foo/bar", Path: otherVolumePath, Opts: []string{"bind"}},
+		))
+	})
+
+	It("does not remount volumes with an operation in progress", func() {
+		stagingPath := GinkgoT().TempDir()
+		n := &node{
+			mounter: &staleMounter{mount.NewFakeMounter([]mount.MountPoint{
+				{Device: "mock-server.test:/foo/bar", Path: stagingPath, Type: "nfs"},
+			})},
+			remountStaleVolumes: true,
+			lazyUnmount: func(path string) error {
+				Fail("Unexpected unmount of " + path)
+				return nil
+			},
+		}
+		done, err := n.inflight.Start(inflight.VolumeKey("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		defer done()
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:          "foo",
+			VolumePath:        volumePath,
+			StagingTargetPath: stagingPath,
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(stats.VolumeCondition.Message).To(ContainSubstring("already in progress"))
+	})
+
+	It("returns an Aborted error while the target path is (un)published", func() {
+		n := &node{mounter: mount.NewFakeMounter(nil)}
+		done, err := n.inflight.Start(inflight.TargetKey(volumePath))
+		Expect(err).ToNot(HaveOccurred())
+		defer done()
+
+		_, err = n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: volumePath,
+		})
+
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+	})
+
+	It("reports volumes as abnormal until staged again if remounting failed", func() {
+		stagingPath := GinkgoT().TempDir()
+		fakeMounter := mount.NewFakeMounter([]mount.MountPoint{
+			{Device: "mock-server.test:/foo/bar", Path: stagingPath, Type: "nfs"},
+			{Device: "mock-server.test:/foo/bar", Path: volumePath, Opts: []string{"bind"}},
+		})
+		n := &node{
+			mounter:             &staleMounter{&failingMounter{fakeMounter}},
+			remountStaleVolumes: true,
+			lazyUnmount:         fakeMounter.Unmount,
+		}
+		req := &csi.NodeGetVolumeStatsRequest{
+			VolumeId:          "foo",
+			VolumePath:        volumePath,
+			StagingTargetPath: stagingPath,
+		}
+
+		stats, err := n.NodeGetVolumeStats(context.TODO(), req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(stats.VolumeCondition.Message).To(ContainSubstring("remounting failed"))
+
+		// the stale mounts are gone, so the volume path isn't a mount anymore
+		n.mounter = fakeMounter
+		stats, err = n.NodeGetVolumeStats(context.TODO(), req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.VolumeCondition.Abnormal).To(BeTrue())
+		Expect(stats.VolumeCondition.Message).To(ContainSubstring("remounting stale volume failed"))
+
+		_, err = n.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{VolumeId: "foo", StagingTargetPath: stagingPath})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = n.NodeGetVolumeStats(context.TODO(), req)
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("returns a NotFound error if the volume path is not a mount", func() {
+		n := &node{mounter: mount.NewFakeMounter(nil)}
+
+		_, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: volumePath,
+		})
+
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("returns a NotFound error if the volume path does not exist", func() {
+		n := &node{mounter: mount.NewFakeMounter(nil)}
+
+		_, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "foo",
+			VolumePath: filepath.Join(volumePath, "missing"),
+		})
+
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("returns an InvalidArgument error when the request check failed", func() {
+		n := &node{}
+
+		_, err := n.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{VolumeId: "foo"})
+
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/klog/v2"
+)
+
+// healthProbeTimeout limits the time probing the components may take per health request.
+const healthProbeTimeout = 5 * time.Second
+
+// serveStatus is the status of the gRPC server reported by the health endpoints.
+type serveStatus int32
+
+const (
+	notServing serveStatus = iota
+	serving
+	// draining is the status while stopping gracefully, waiting for requests in progress.
+	draining
+)
+
+// healthServer serves the health of the driver over HTTP, replacing the liveness-probe sidecar:
+//
+//   - /healthz fails if the gRPC server is not serving or the components are not ready,
+//     but not while draining, as restarting the driver would abort the requests in progress.
+//   - /readyz fails additionally while draining.
+type healthServer struct {
+	listener net.Listener
+	server   *http.Server
+
+	// identity is probed for the readiness of the components, not probed if nil.
+	identity csi.IdentityServer
+	status   atomic.Int32
+}
+
+func newHealthServer(address string, identity csi.IdentityServer) (*healthServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &healthServer{
+		listener: listener,
+		identity: identity,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.handler(serving, draining))
+	mux.HandleFunc("/readyz", h.handler(serving))
+	h.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	return h, nil
+}
+
+// setStatus sets the status of the gRPC server.
+func (h *healthServer) setStatus(status serveStatus) {
+	h.status.Store(int32(status))
+}
+
+// handler returns a handler succeeding if the gRPC server has one of the given statuses and the
+// components are ready.
+func (h *healthServer) handler(healthy ...serveStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.check(r.Context(), healthy); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (h *healthServer) check(ctx context.Context, healthy []serveStatus) error {
+	status := serveStatus(h.status.Load())
+	if !slices.Contains(healthy, status) {
+		return fmt.Errorf("grpc: %s", status)
+	}
+
+	if h.identity == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	resp, err := h.identity.Probe(ctx, &csi.ProbeRequest{})
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	// an unset ready field means ready, see the CSI spec
+	if ready := resp.GetReady(); ready != nil && !ready.GetValue() {
+		return errors.New("probe: not ready, see the logs of the driver for the reasons")
+	}
+
+	return nil
+}
+
+// run serves the health endpoints until the server is shut down.
+func (h *healthServer) run() {
+	klog.V(2).InfoS("Serving health endpoints", "address", h.listener.Addr())
+	if err := h.server.Serve(h.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.V(0).ErrorS(err, "Serving health endpoints failed")
+	}
+}
+
+// shutdown stops serving the health endpoints, waiting for requests in progress until the context is done.
+func (h *healthServer) shutdown(ctx context.Context) {
+	if err := h.server.Shutdown(ctx); err != nil {
+		klog.V(1).ErrorS(err, "Stopping health server failed")
+	}
+}
+
+func (s serveStatus) String() string {
+	switch s {
+	case serving:
+		return "serving"
+	case draining:
+		return "draining"
+	}
+
+	return "not serving"
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// probedIdentity reports the given readiness when probed.
+type probedIdentity struct {
+	csi.UnimplementedIdentityServer
+	ready bool
+}
+
+func (pi probedIdentity) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(pi.ready)}, nil
+}
+
+func TestHealthServer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  serveStatus
+		ready   bool
+		healthz int
+		readyz  int
+	}{
+		{"serving", serving, true, http.StatusOK, http.StatusOK},
+		{"draining", draining, true, http.StatusOK, http.StatusServiceUnavailable},
+		{"not serving", notServing, true, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"not ready", serving, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := newHealthServer("127.0.0.1:0", probedIdentity{ready: tt.ready})
+			if err != nil {
+				t.Fatalf("Expected no error creating the health server, got %#v", err)
+			}
+			defer h.listener.Close()
+			h.setStatus(tt.status)
+
+			for path, expected := range map[string]int{"/healthz": tt.healthz, "/readyz": tt.readyz} {
+				rec := httptest.NewRecorder()
+				h.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != expected {
+					t.Fatalf("Expected %s to return %d, got %d: %s", path, expected, rec.Code, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestRunServesHealth(t *testing.T) {
+	t.Parallel()
+
+	srv, err := New(Options{
+		Endpoint:      "unix://" + filepath.Join(t.TempDir(), "csi.sock"),
+		HealthAddress: "127.0.0.1:0",
+		Identity:      probedIdentity{ready: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, got %#v", err)
+	}
+	readyURL := "http://" + srv.(*server).health.listener.Addr().String() + "/readyz"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(readyURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to become ready, got %v, %#v", resp, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
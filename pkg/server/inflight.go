@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// inflightRequests counts the requests in progress by their method, to report the requests
+// aborted when stopping the server.
+type inflightRequests struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (r *inflightRequests) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	r.mu.Lock()
+	if r.requests == nil {
+		r.requests = make(map[string]int)
+	}
+	r.requests[info.FullMethod]++
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.requests[info.FullMethod]--; r.requests[info.FullMethod] == 0 {
+			delete(r.requests, info.FullMethod)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// len returns the number of requests in progress.
+func (r *inflightRequests) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, count := range r.requests {
+		n += count
+	}
+	return n
+}
+
+// snapshot returns the number of requests in progress by their method.
+func (r *inflightRequests) snapshot() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return maps.Clone(r.requests)
+}
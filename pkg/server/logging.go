@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/anexia/csi-driver/pkg/internal/redact"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+)
+
+// loggingInterceptor stores a logger in the context of requests, which adds the method, an ID of
+// the request and the volume or snapshot the request is for to all log lines of the request.
+// The request itself is logged with its secrets redacted at verbosity 4.
+func loggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	logger := klog.FromContext(ctx).WithValues(requestValues(ctx, req, info)...)
+	if msg, ok := req.(proto.Message); ok {
+		logger.V(4).Info("Handling request", "request", redact.Secrets(msg))
+	}
+	return handler(klog.NewContext(ctx, logger), req)
+}
+
+// requestValues returns the key/value pairs identifying the given request in logs.
+func requestValues(ctx context.Context, req any, info *grpc.UnaryServerInfo) []any {
+	values := []any{"method", info.FullMethod, "request_id", newRequestID()}
+
+	// correlate the logs with the trace of the request
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		values = append(values, "trace_id", spanContext.TraceID().String())
+	}
+
+	switch req := req.(type) {
+	case *csi.CreateVolumeRequest:
+		values = append(values, "volume_name", req.GetName())
+	case *csi.CreateSnapshotRequest:
+		values = append(values, "snapshot_name", req.GetName(), "volume_id", req.GetSourceVolumeId())
+	case interface{ GetVolumeId() string }:
+		if id := req.GetVolumeId(); id != "" {
+			values = append(values, "volume_id", id)
+		}
+	case interface{ GetSnapshotId() string }:
+		if id := req.GetSnapshotId(); id != "" {
+			values = append(values, "snapshot_id", id)
+		}
+	}
+
+	return values
+}
+
+// newRequestID returns a random ID to group the log lines of a request by.
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
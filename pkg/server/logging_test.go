@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/go-logr/logr/funcr"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Parallel()
+
+	var lines []string
+	logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{})
+	ctx := klog.NewContext(context.Background(), logger)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/DeleteVolume"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		klog.FromContext(ctx).Info("Deleting volume")
+		return nil, nil
+	}
+
+	for range 2 {
+		if _, err := loggingInterceptor(ctx, &csi.DeleteVolumeRequest{VolumeId: "foo"}, info, handler); err != nil {
+			t.Fatalf("Expected no error, got %#v", err)
+		}
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected two log lines, got %v", lines)
+	}
+	for _, expected := range []string{`"method"="/csi.v1.Controller/DeleteVolume"`, `"volume_id"="foo"`, `"request_id"=`} {
+		if !strings.Contains(lines[0], expected) {
+			t.Fatalf("Expected log line to contain %s, got %s", expected, lines[0])
+		}
+	}
+	if requestID := func(line string) string { return line[strings.Index(line, `"request_id"=`):] }; requestID(lines[0]) == requestID(lines[1]) {
+		t.Fatalf("Expected requests to get different IDs, got %v", lines)
+	}
+}
+
+func TestRequestValues(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/Method"}
+	traced := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	}))
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		req      any
+		expected []any
+	}{
+		{"CreateVolume", context.Background(), &csi.CreateVolumeRequest{Name: "pvc-1"}, []any{"volume_name", "pvc-1"}},
+		{"CreateSnapshot", context.Background(), &csi.CreateSnapshotRequest{Name: "snap-1", SourceVolumeId: "foo"}, []any{"snapshot_name", "snap-1", "volume_id", "foo"}},
+		{"NodePublishVolume", context.Background(), &csi.NodePublishVolumeRequest{VolumeId: "foo"}, []any{"volume_id", "foo"}},
+		{"DeleteSnapshot", context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "bar"}, []any{"snapshot_id", "bar"}},
+		{"ListVolumes", context.Background(), &csi.ListVolumesRequest{}, []any{}},
+		{"traced request", traced, &csi.ListVolumesRequest{}, []any{"trace_id", trace.TraceID{1}.String()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			values := requestValues(tt.ctx, tt.req, info)
+			if values[0] != "method" || values[1] != info.FullMethod || values[2] != "request_id" {
+				t.Fatalf("Expected method and request ID, got %v", values)
+			}
+			if rest := values[4:]; !slices.Equal(rest, tt.expected) {
+				t.Fatalf("Expected values %v, got %v", tt.expected, rest)
+			}
+		})
+	}
+}
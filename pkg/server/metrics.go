@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anexia/csi-driver/pkg/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// metricsInterceptor records the duration and gRPC code of all requests in the metrics.
+func metricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	metrics.GRPCRequestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(metrics.Since(start))
+
+	return resp, err
+}
+
+// metricsServer serves the metrics over HTTP.
+type metricsServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+func newMetricsServer(address string) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	return &metricsServer{
+		listener: listener,
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}, nil
+}
+
+// run serves the metrics until the server is shut down.
+func (m *metricsServer) run() {
+	klog.V(2).InfoS("Serving metrics", "address", m.listener.Addr())
+	if err := m.server.Serve(m.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.V(0).ErrorS(err, "Serving metrics failed")
+	}
+}
+
+// shutdown stops serving the metrics, waiting for requests in progress until the context is done.
+func (m *metricsServer) shutdown(ctx context.Context) {
+	if err := m.server.Shutdown(ctx); err != nil {
+		klog.V(1).ErrorS(err, "Stopping metrics server failed")
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anexia/csi-driver/pkg/internal/metrics"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func grpcRequestCount(t *testing.T, method, code string) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := metrics.GRPCRequestDuration.WithLabelValues(method, code).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Expected no error reading the metric, got %#v", err)
+	}
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRunServesMetrics(t *testing.T) {
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "csi.sock")
+	srv, err := New(Options{
+		Endpoint:       "unix://" + socketPath,
+		MetricsAddress: "127.0.0.1:0",
+		Identity:       &csi.UnimplementedIdentityServer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, got %#v", err)
+	}
+	metricsURL := "http://" + srv.(*server).metrics.listener.Addr().String() + "/metrics"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Run(ctx) }()
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Expected no error connecting to the server, got %#v", err)
+	}
+	defer conn.Close()
+
+	const method = "/csi.v1.Identity/GetPluginInfo"
+	before := grpcRequestCount(t, method, "Unimplemented")
+	if _, err := csi.NewIdentityClient(conn).GetPluginInfo(context.Background(), &csi.GetPluginInfoRequest{}); err == nil {
+		t.Fatal("Expected the unimplemented method to return an error")
+	}
+	if count := grpcRequestCount(t, method, "Unimplemented"); count != before+1 {
+		t.Fatalf("Expected the request to be recorded, got %d after %d", count, before)
+	}
+
+	resp, err := http.Get(metricsURL)
+	if err != nil {
+		t.Fatalf("Expected no error getting the metrics, got %#v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Expected no error reading the metrics, got %#v", err)
+	}
+	if !strings.Contains(string(body), `anexia_csi_grpc_request_duration_seconds_count{code="Unimplemented",method="`+method+`"}`) {
+		t.Fatalf("Expected the request to be served in the metrics, got %s", body)
+	}
+}
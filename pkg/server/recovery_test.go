@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecoveryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/ControllerExpandVolume"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		var capacityRange *struct{ RequiredBytes int64 }
+		return capacityRange.RequiredBytes, nil
+	}
+
+	resp, err := recoveryInterceptor(context.Background(), nil, info, handler)
+	if resp != nil {
+		t.Fatalf("Expected no response, got %v", resp)
+	}
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Expected Internal error, got %#v", err)
+	}
+}
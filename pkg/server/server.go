@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"time"
 
 	"github.com/anexia/csi-driver/pkg/version"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"k8s.io/klog/v2"
 )
 
@@ -17,6 +19,17 @@ type server struct {
 
 	listener net.Listener
 	server   *grpc.Server
+
+	// socketPath is the path of the unix socket to remove when stopping, empty for other protocols.
+	socketPath   string
+	drainTimeout time.Duration
+	requests     *inflightRequests
+
+	// metrics serves the metrics, nil if disabled.
+	metrics *metricsServer
+
+	// health serves the health endpoints, nil if disabled.
+	health *healthServer
 }
 
 // New creates a new Server instance, checking some parts of the configuration
@@ -28,6 +41,22 @@ func New(opts Options) (Server, error) {
 		return nil, err
 	}
 
+	var serverOpts []grpc.ServerOption
+	if opts.TLS.enabled() {
+		if err := opts.TLS.validate(); err != nil {
+			return nil, err
+		}
+
+		certs, err := newCertReloader(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(certs.config())))
+	} else if protocol == "tcp" && !opts.AllowInsecureTCP {
+		return nil, fmt.Errorf("%w: serving on tcp requires TLS, configure a certificate or explicitly allow insecure tcp", ErrInsecureEndpoint)
+	}
+
 	if protocol == "unix" {
 		if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
 			return nil, fmt.Errorf("error deleting existing object at socket path: %w", err)
@@ -39,7 +68,34 @@ func New(opts Options) (Server, error) {
 		return nil, fmt.Errorf("error listening on endpoint: %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	var metrics *metricsServer
+	if opts.MetricsAddress != "" {
+		if metrics, err = newMetricsServer(opts.MetricsAddress); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("error listening on metrics address: %w", err)
+		}
+	}
+
+	var health *healthServer
+	if opts.HealthAddress != "" {
+		if health, err = newHealthServer(opts.HealthAddress, opts.Identity); err != nil {
+			listener.Close()
+			if metrics != nil {
+				metrics.listener.Close()
+			}
+			return nil, fmt.Errorf("error listening on health address: %w", err)
+		}
+	}
+
+	requests := &inflightRequests{}
+	serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(
+		tracingInterceptor,
+		loggingInterceptor,
+		metricsInterceptor,
+		requests.unaryInterceptor,
+		recoveryInterceptor,
+	))
+	grpcServer := grpc.NewServer(serverOpts...)
 
 	if opts.Identity != nil {
 		csi.RegisterIdentityServer(grpcServer, opts.Identity)
@@ -53,16 +109,25 @@ func New(opts Options) (Server, error) {
 		csi.RegisterNodeServer(grpcServer, opts.Node)
 	}
 
-	return &server{
-		nodeID:   opts.NodeID,
-		listener: listener,
-		server:   grpcServer,
-	}, nil
+	srv := &server{
+		nodeID:       opts.NodeID,
+		listener:     listener,
+		server:       grpcServer,
+		drainTimeout: opts.DrainTimeout,
+		requests:     requests,
+		metrics:      metrics,
+		health:       health,
+	}
+	if protocol == "unix" {
+		srv.socketPath = endpoint
+	}
+
+	return srv, nil
 }
 
 // Run starts the main loop of the Server instance and loops itself, checking
-// if the server returned an error and stopping it when the given context is
-// cancelled.
+// if the server returned an error and stopping it gracefully when the given
+// context is cancelled.
 //
 // Call this method in a goroutine.
 func (s *server) Run(ctx context.Context) error {
@@ -72,20 +137,102 @@ func (s *server) Run(ctx context.Context) error {
 		"node-id", s.nodeID,
 	)
 
-	ec := make(chan error)
+	if s.metrics != nil {
+		go s.metrics.run()
+		defer s.stopMetrics()
+	}
+
+	if s.health != nil {
+		go s.health.run()
+		defer s.stopHealth()
+	}
+
+	ec := make(chan error, 1)
 	go func() {
 		ec <- s.server.Serve(s.listener)
 	}()
+	s.setServeStatus(serving)
 
-	for {
-		select {
-		case err := <-ec:
-			if err != nil {
-				return err
-			}
-			return ctx.Err()
-		case <-ctx.Done():
-			s.server.Stop()
+	select {
+	case err := <-ec:
+		s.setServeStatus(notServing)
+		s.removeSocket()
+		return err
+	case <-ctx.Done():
+	}
+
+	s.setServeStatus(draining)
+	defer s.setServeStatus(notServing)
+
+	// Serve only returns once all handlers returned, which aborted ones may never do.
+	if timedOut := s.stop(); !timedOut {
+		if err := <-ec; err != nil {
+			return err
 		}
 	}
+
+	return ctx.Err()
+}
+
+// stop stops the server gracefully, waiting for requests in progress up to the drain timeout.
+// Requests still in progress afterwards are aborted, returning if the drain timeout passed.
+func (s *server) stop() bool {
+	klog.V(1).InfoS("Stopping server, waiting for requests in progress", "drain_timeout", s.drainTimeout, "requests", s.requests.len())
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	var (
+		timedOut bool
+		aborted  map[string]int
+	)
+	select {
+	case <-stopped:
+	case <-time.After(s.drainTimeout):
+		timedOut, aborted = true, s.requests.snapshot()
+		// Stop blocks while GracefulStop waits for handlers, which may ignore the cancellation.
+		go s.server.Stop()
+	}
+
+	s.removeSocket()
+	klog.V(0).InfoS("Server stopped", "aborted_requests", aborted)
+
+	return timedOut
+}
+
+// stopMetrics stops serving the metrics, after the last requests were recorded.
+func (s *server) stopMetrics() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.metrics.shutdown(ctx)
+}
+
+// stopHealth stops serving the health endpoints.
+func (s *server) stopHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.health.shutdown(ctx)
+}
+
+// setServeStatus sets the status of the gRPC server reported by the health endpoints.
+func (s *server) setServeStatus(status serveStatus) {
+	if s.health != nil {
+		s.health.setStatus(status)
+	}
+}
+
+// removeSocket removes the unix socket the server was listening on.
+func (s *server) removeSocket() {
+	if s.socketPath == "" {
+		return
+	}
+
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		klog.V(1).ErrorS(err, "Removing socket failed", "path", s.socketPath)
+	}
 }
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// blockingIdentity blocks probe requests until unblock is closed.
+type blockingIdentity struct {
+	csi.UnimplementedIdentityServer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (bi *blockingIdentity) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	close(bi.started)
+	<-bi.unblock
+	return &csi.ProbeResponse{}, nil
+}
+
+func TestRunStopsGracefully(t *testing.T) {
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "csi.sock")
+	identity := &blockingIdentity{started: make(chan struct{}), unblock: make(chan struct{})}
+
+	srv, err := New(Options{
+		Endpoint:     "unix://" + socketPath,
+		DrainTimeout: time.Minute,
+		Identity:     identity,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, got %#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Expected no error connecting to the server, got %#v", err)
+	}
+	defer conn.Close()
+
+	probeErr := make(chan error, 1)
+	go func() {
+		_, err := csi.NewIdentityClient(conn).Probe(context.Background(), &csi.ProbeRequest{})
+		probeErr <- err
+	}()
+
+	<-identity.started
+	cancel()
+
+	select {
+	case err := <-runErr:
+		t.Fatalf("Expected server to wait for the request in progress, but it returned %#v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(identity.unblock)
+
+	if err := <-probeErr; err != nil {
+		t.Fatalf("Expected request in progress to succeed, got %#v", err)
+	}
+	if err := <-runErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %#v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected socket to be removed, got %#v", err)
+	}
+}
+
+func TestRunAbortsAfterDrainTimeout(t *testing.T) {
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "csi.sock")
+	identity := &blockingIdentity{started: make(chan struct{}), unblock: make(chan struct{})}
+	defer close(identity.unblock)
+
+	srv, err := New(Options{
+		Endpoint:     "unix://" + socketPath,
+		DrainTimeout: 10 * time.Millisecond,
+		Identity:     identity,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, got %#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Expected no error connecting to the server, got %#v", err)
+	}
+	defer conn.Close()
+
+	probeErr := make(chan error, 1)
+	go func() {
+		_, err := csi.NewIdentityClient(conn).Probe(context.Background(), &csi.ProbeRequest{})
+		probeErr <- err
+	}()
+
+	<-identity.started
+	cancel()
+
+	if err := <-runErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %#v", err)
+	}
+	if err := <-probeErr; err == nil {
+		t.Fatalf("Expected request in progress to be aborted")
+	}
+}
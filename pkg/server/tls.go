@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// TLSOptions configures TLS for the endpoint of the server. The files are read again
+// whenever they change, so certificates can be rotated without restarting.
+type TLSOptions struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate and key of the server.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the path of the PEM encoded CA certificates to verify client
+	// certificates with. If set, clients have to present a certificate signed by one of them.
+	ClientCAFile string
+}
+
+func (o TLSOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.ClientCAFile != ""
+}
+
+func (o TLSOptions) validate() error {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return errors.New("both certificate and key file are required for TLS")
+	}
+
+	return nil
+}
+
+// certReloader loads the certificates for TLS and loads them again once their files change.
+type certReloader struct {
+	opts TLSOptions
+
+	mu        sync.Mutex
+	modTimes  map[string]time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertReloader(opts TLSOptions) (*certReloader, error) {
+	r := &certReloader{opts: opts}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// files returns the paths of all files configured.
+func (r *certReloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+
+	return files
+}
+
+// reload loads the files again if any of them changed since they were loaded last,
+// returning if they were loaded. Must be called with r.mu held or before r is shared.
+func (r *certReloader) reload() (bool, error) {
+	modTimes := make(map[string]time.Time, 3)
+	changed := false
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, fmt.Errorf("error reading TLS file: %w", err)
+		}
+
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("error reading TLS client CA file: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in TLS client CA file %q", r.opts.ClientCAFile)
+		}
+	}
+
+	r.modTimes = modTimes
+	r.cert = &cert
+	r.clientCAs = clientCAs
+
+	return true, nil
+}
+
+// getConfigForClient returns the TLS configuration for a new connection, with the current
+// certificates. Changed files failing to load are logged and the previous certificates kept.
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if reloaded, err := r.reload(); err != nil {
+		klog.V(1).ErrorS(err, "Reloading TLS certificates failed, keeping the previous ones")
+	} else if reloaded {
+		klog.V(2).InfoS("Reloaded TLS certificates", "files", r.files())
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		// Set by the gRPC transport credentials on the base configuration only.
+		NextProtos: []string{"h2"},
+	}
+	if r.clientCAs != nil {
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// config returns the TLS configuration to serve with.
+func (r *certReloader) config() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// testCert is a certificate with its key, signed by the CA given when creating it.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, ca *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected no error generating key, got %#v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Expected no error creating certificate, got %#v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Expected no error parsing certificate, got %#v", err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Expected no error marshalling key, got %#v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM(), c.keyPEM(t))
+	if err != nil {
+		t.Fatalf("Expected no error loading key pair, got %#v", err)
+	}
+
+	return cert
+}
+
+// writeFile writes the file with the given modification time, as its resolution may be too low
+// to notice files written in quick succession.
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Expected no error writing %q, got %#v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Expected no error setting modification time of %q, got %#v", path, err)
+	}
+}
+
+// writeTLSFiles writes the given server certificate and client CA, returning the options to use them.
+func writeTLSFiles(t *testing.T, dir string, cert, clientCA *testCert, modTime time.Time) TLSOptions {
+	t.Helper()
+
+	opts := TLSOptions{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	writeFile(t, opts.CertFile, cert.certPEM(), modTime)
+	writeFile(t, opts.KeyFile, cert.keyPEM(t), modTime)
+
+	if clientCA != nil {
+		opts.ClientCAFile = filepath.Join(dir, "ca.crt")
+		writeFile(t, opts.ClientCAFile, clientCA.certPEM(), modTime)
+	}
+
+	return opts
+}
+
+func TestNewRejectsInsecureTCP(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(Options{Endpoint: "tcp://127.0.0.1:0"})
+	if !errors.Is(err, ErrInsecureEndpoint) {
+		t.Fatalf("Expected ErrInsecureEndpoint, got %#v", err)
+	}
+
+	srv, err := New(Options{Endpoint: "tcp://127.0.0.1:0", AllowInsecureTCP: true})
+	if err != nil {
+		t.Fatalf("Expected no error when allowing insecure tcp, got %#v", err)
+	}
+	srv.(*server).listener.Close()
+}
+
+func TestNewRejectsIncompleteTLSOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(Options{Endpoint: "tcp://127.0.0.1:0", TLS: TLSOptions{ClientCAFile: "ca.crt"}})
+	if err == nil {
+		t.Fatal("Expected an error without certificate and key")
+	}
+}
+
+func TestRunServesMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCert(t, "ca", nil)
+	opts := writeTLSFiles(t, t.TempDir(), newTestCert(t, "server", ca), ca, time.Now())
+
+	srv, err := New(Options{
+		Endpoint: "tcp://127.0.0.1:0",
+		TLS:      opts,
+		Identity: &csi.UnimplementedIdentityServer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, got %#v", err)
+	}
+	address := srv.(*server).listener.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Run(ctx) }()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+
+	probe := func(clientCerts ...tls.Certificate) error {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: rootCAs, Certificates: clientCerts})
+		conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatalf("Expected no error connecting to the server, got %#v", err)
+		}
+		defer conn.Close()
+
+		_, err = csi.NewIdentityClient(conn).GetPluginInfo(context.Background(), &csi.GetPluginInfoRequest{})
+		return err
+	}
+
+	// the unimplemented server returns an error, but only after the handshake
+	if err := probe(newTestCert(t, "client", ca).tlsCertificate(t)); !isUnimplemented(err) {
+		t.Fatalf("Expected the request with a client certificate to reach the server, got %#v", err)
+	}
+	if err := probe(); err == nil || isUnimplemented(err) {
+		t.Fatalf("Expected the request without a client certificate to be rejected, got %#v", err)
+	}
+	if err := probe(newTestCert(t, "client", newTestCert(t, "other-ca", nil)).tlsCertificate(t)); err == nil || isUnimplemented(err) {
+		t.Fatalf("Expected the request with a client certificate of another CA to be rejected, got %#v", err)
+	}
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	first := newTestCert(t, "first", ca)
+	opts := writeTLSFiles(t, dir, first, nil, time.Now().Add(-time.Minute))
+
+	r, err := newCertReloader(opts)
+	if err != nil {
+		t.Fatalf("Expected no error loading the certificates, got %#v", err)
+	}
+
+	assertServedCert := func(expected *testCert) {
+		t.Helper()
+
+		config, err := r.getConfigForClient(nil)
+		if err != nil {
+			t.Fatalf("Expected no error getting the configuration, got %#v", err)
+		}
+		if cn := config.Certificates[0].Leaf.Subject.CommonName; cn != expected.cert.Subject.CommonName {
+			t.Fatalf("Expected certificate %q to be served, got %q", expected.cert.Subject.CommonName, cn)
+		}
+		if config.ClientAuth != tls.NoClientCert {
+			t.Fatalf("Expected no client certificate to be required, got %v", config.ClientAuth)
+		}
+	}
+
+	assertServedCert(first)
+
+	second := newTestCert(t, "second", ca)
+	writeTLSFiles(t, dir, second, nil, time.Now())
+	assertServedCert(second)
+
+	// a broken certificate keeps the previous one in use
+	writeFile(t, opts.CertFile, []byte("garbage"), time.Now().Add(time.Minute))
+	assertServedCert(second)
+}
+
+func isUnimplemented(err error) bool {
+	return status.Code(err) == codes.Unimplemented
+}
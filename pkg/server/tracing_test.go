@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anexia/csi-driver/pkg/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTracingInterceptor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/DeleteVolume"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		_ = tracing.Run(ctx, "engine.destroy", func(context.Context) error { return nil })
+		return nil, status.Error(grpccodes.Internal, "mock error")
+	}
+
+	if _, err := tracingInterceptor(context.Background(), nil, info, handler); status.Code(err) != grpccodes.Internal {
+		t.Fatalf("Expected the error of the handler to be returned, got %#v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a span for the request and one for the handler, got %d", len(spans))
+	}
+
+	child, request := spans[0], spans[1]
+	if request.Name != info.FullMethod || request.Status.Code != codes.Error {
+		t.Fatalf("Expected the failed request to be traced, got %#v", request)
+	}
+	if child.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Fatalf("Expected the span of the handler to be a child of the request, got %#v", child)
+	}
+	for _, attr := range request.Attributes {
+		if attr.Key == "rpc.grpc.status_code" && attr.Value.AsString() == "Internal" {
+			return
+		}
+	}
+	t.Fatalf("Expected the gRPC code to be recorded, got %#v", request.Attributes)
+}
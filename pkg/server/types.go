@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 )
@@ -13,6 +14,9 @@ var (
 
 	// ErrInvalidEndpoint is returned when requesting to serve with an unknown protocol.
 	ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+	// ErrInsecureEndpoint is returned when requesting to serve on a tcp endpoint without TLS.
+	ErrInsecureEndpoint = errors.New("insecure endpoint")
 )
 
 // Options configures a Server instance to create.
@@ -20,6 +24,21 @@ type Options struct {
 	NodeID   string
 	Endpoint string
 
+	// DrainTimeout is the time to wait for requests in progress when stopping the server,
+	// before aborting them.
+	DrainTimeout time.Duration
+
+	// TLS configures TLS for the endpoint, which is required for tcp endpoints unless
+	// AllowInsecureTCP is set.
+	TLS              TLSOptions
+	AllowInsecureTCP bool
+
+	// MetricsAddress is the address to serve the Prometheus metrics on, not served if empty.
+	MetricsAddress string
+
+	// HealthAddress is the address to serve /healthz and /readyz on, not served if empty.
+	HealthAddress string
+
 	Identity   csi.IdentityServer
 	Controller csi.ControllerServer
 	Node       csi.NodeServer
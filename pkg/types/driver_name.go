@@ -0,0 +1,4 @@
+package types
+
+// DriverName is the name of the CSI driver, as registered to kubelet.
+const DriverName = "csi.anx.io"
@@ -0,0 +1,36 @@
+package types
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// nodeIDSeparator separates the node name from its IP address in node IDs. It's
+// neither valid in node names nor in IP addresses.
+const nodeIDSeparator = "@"
+
+// NodeID builds the ID a node registers itself with. A valid IP address is encoded
+// into the ID, allowing the controller to grant the node access to volumes.
+func NodeID(name string, addr netip.Addr) string {
+	if !addr.IsValid() {
+		return name
+	}
+
+	return name + nodeIDSeparator + addr.String()
+}
+
+// NodeAddressFromID returns the IP address encoded into the given node ID. The
+// second return value is false if the node ID contains no valid IP address.
+func NodeAddressFromID(nodeID string) (netip.Addr, bool) {
+	_, encodedAddr, found := strings.Cut(nodeID, nodeIDSeparator)
+	if !found {
+		return netip.Addr{}, false
+	}
+
+	addr, err := netip.ParseAddr(encodedAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr, true
+}
@@ -0,0 +1,10 @@
+package types
+
+import "context"
+
+// Prober is implemented by components able to check if they are ready to serve requests,
+// which is reported by the Probe call of the identity component.
+type Prober interface {
+	// Probe returns why the component is not ready, nil if it is.
+	Probe(ctx context.Context) error
+}
@@ -0,0 +1,5 @@
+package types
+
+// TopologyKeyLocation is the key of the topology segment containing the identifier
+// of the Anexia Engine location a node or storage server interface is in.
+const TopologyKeyLocation = "topology.csi.anx.io/location"
@@ -0,0 +1,11 @@
+package types
+
+const (
+	// VolumeContextNFSVersion is the key of the volume context entry containing the NFS
+	// protocol version to mount the volume with.
+	VolumeContextNFSVersion = "nfsVersion"
+
+	// VolumeContextMountOptions is the key of the volume context entry containing the
+	// comma-separated default mount options of the volume.
+	VolumeContextMountOptions = "mountOptions"
+)